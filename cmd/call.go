@@ -18,6 +18,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
@@ -45,6 +46,9 @@ var callCmd = &cobra.Command{
 			}
 			clientOptions.Data = &data
 		}
+		if clientOptions.UseSSE && !cmd.Flags().Changed("path") {
+			clientOptions.Path = "/sse"
+		}
 		client.Run(clientOptions)
 	},
 }
@@ -72,4 +76,25 @@ func init() {
 	callCmd.Flags().StringVar(&clientOptions.Protocol, "proto", "http", "The request protocol")
 	callCmd.Flags().StringVar(&clientOptions.RequestID, "id", "", "The x-request-id to use for each request, if blank a new ID will be generated for each request")
 	callCmd.Flags().StringVar(&clientOptions.Verb, "verb", "POST", "The http verb to use for each request")
+	callCmd.Flags().StringVar(&clientOptions.TLSCAFile, "tls-ca", "", "Path to a PEM encoded CA bundle used to verify the server certificate")
+	callCmd.Flags().StringVar(&clientOptions.TLSCertFile, "tls-cert", "", "Path to a PEM encoded client certificate, used with --tls-key for mutual TLS")
+	callCmd.Flags().StringVar(&clientOptions.TLSKeyFile, "tls-key", "", "Path to the PEM encoded private key for --tls-cert")
+	callCmd.Flags().BoolVarP(&clientOptions.TLSInsecureSkipVerify, "insecure", "k", false, "Skip verification of the server certificate chain and host name")
+	callCmd.Flags().StringVar(&clientOptions.TLSServerName, "sni", "", "Override the server name sent in the TLS handshake and used for certificate verification")
+	callCmd.Flags().BoolVar(&clientOptions.HTTP2, "http2", false, "Force HTTP/2 over TLS, negotiated with ALPN. Requires --proto=https")
+	callCmd.Flags().BoolVar(&clientOptions.H2C, "h2c", false, "Use HTTP/2 over cleartext (prior knowledge) for each request")
+	callCmd.Flags().BoolVar(&clientOptions.UseGRPC, "grpc", false, "Call the grpc Echo service instead of sending http requests")
+	callCmd.Flags().StringVar(&clientOptions.GRPCMethod, "grpc-method", client.GRPCUnary, "The grpc Echo method to call: unary, server-stream or bidi. When used with --interval, the streaming methods keep a single stream open")
+	callCmd.Flags().BoolVar(&clientOptions.UseSSE, "sse", false, "Consume the server-sent event stream at --path (default /sse), reconnecting with Last-Event-ID and reporting missed events until interrupted. Missed events are counted from the server clock, across backends this assumes the same --sse-rate and synchronized clocks")
+	callCmd.Flags().IntVarP(&clientOptions.Concurrency, "concurrency", "c", 0, "Number of workers sending requests at the same time. Enables load mode")
+	callCmd.Flags().Float64Var(&clientOptions.Rate, "rate", 0, "Requests per second across all workers, fractions are allowed. Enables load mode, unlimited when 0")
+	callCmd.Flags().DurationVar(&clientOptions.Duration, "duration", 0, "Stop sending requests after this long, e.g. 30s or 5m. Enables load mode")
+	callCmd.Flags().IntVar(&clientOptions.Requests, "requests", 0, "Stop after this many requests have been sent. Enables load mode")
+	callCmd.Flags().StringVar(&clientOptions.SummaryFormat, "summary", client.SummaryTable, "Format of the summary printed when a continuous http run ends: table, json or none. Websocket, grpc and sse calls do not print a summary")
+	callCmd.Flags().BoolVar(&clientOptions.Verdict, "verdict", false, "Track windows of consecutive failed requests and print a pass/fail verdict when the run ends, even with --summary none. Exits with 1 when the run fails. Cannot be combined with --exit")
+	callCmd.Flags().IntVar(&clientOptions.MaxErrors, "max-errors", 0, "Failed requests allowed before the verdict fails")
+	callCmd.Flags().DurationVar(&clientOptions.MaxDowntime, "max-downtime", 0, "Longest window of consecutive failures allowed before the verdict fails, e.g. 500ms. Not checked when 0")
+	callCmd.Flags().DurationSliceVar(&clientOptions.BackendWindows, "backend-windows", []time.Duration{10 * time.Second, time.Minute}, "Sliding windows over which requests per backend hostname and version label are logged during a continuous run. Disabled when empty")
+	callCmd.Flags().IntVar(&clientOptions.MetricsPort, "metrics-port", 0, "Serve Prometheus metrics about the calls on this port. Disabled when 0")
+	callCmd.Flags().StringVar(&clientOptions.TLSMinVersion, "tls-min-version", "", "The minimum TLS version to accept: 1.0, 1.1, 1.2 or 1.3")
 }
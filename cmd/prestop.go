@@ -0,0 +1,54 @@
+/*
+Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+
+	"github.com/aka-bo/loqu/pkg/prestop"
+)
+
+var prestopOptions = &prestop.Options{
+	Host:                "localhost",
+	TimeoutSeconds:      30,
+	PollIntervalSeconds: 1,
+}
+
+// prestopCmd represents the prestop command
+var prestopCmd = &cobra.Command{
+	Use:   "prestop",
+	Short: "Drain the local server and wait for in-flight requests to finish",
+	Long: `Starts a drain through the admin API of a local "loqu serve" and waits until
+no requests are in flight. Intended for use as a Kubernetes preStop hook, it
+exits non-zero if the drain does not finish before the timeout.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		glog.Infoln("prestop called")
+		defer glog.Flush()
+		prestop.Run(prestopOptions)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(prestopCmd)
+
+	prestopCmd.Flags().StringVarP(&prestopOptions.Host, "host", "H", prestopOptions.Host, "The host running the server")
+	prestopCmd.Flags().IntVar(&prestopOptions.AdminPort, "admin-port", 0, "The admin port of the server, see serve --admin-port")
+	prestopCmd.Flags().IntVarP(&prestopOptions.TimeoutSeconds, "timeout", "t", prestopOptions.TimeoutSeconds, "Amount of time (in seconds) to wait for in-flight requests to finish")
+	prestopCmd.Flags().IntVar(&prestopOptions.MinWaitSeconds, "min-wait", 0, "Minimum amount of time (in seconds) to wait, even when no requests are in flight, so load balancers stop sending new requests")
+	prestopCmd.Flags().Float64Var(&prestopOptions.PollIntervalSeconds, "poll-interval", prestopOptions.PollIntervalSeconds, "Interval (in seconds) between checks of the server state")
+	prestopCmd.MarkFlagRequired("admin-port")
+}
@@ -16,8 +16,12 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"github.com/aka-bo/loqu/pkg/server"
 )
@@ -29,6 +33,19 @@ var serveCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		glog.Info("serve called")
 
+		if err := loadProbes(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := loadHistoryFile(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := loadFaults(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
 		glog.Infof("calling server.Run()")
 		server.Run(options)
 
@@ -36,8 +53,68 @@ var serveCmd = &cobra.Command{
 }
 
 var options = &server.Options{
-	ShutdownDelaySeconds: 15,
-	ListenPort:           80,
+	ShutdownDelaySeconds:   15,
+	ShutdownTimeoutSeconds: 30,
+	ListenPort:             80,
+}
+
+var faultSpecs []string
+
+var historyFileMaxSize = "10MiB"
+
+var probeDraining = struct {
+	livez, readyz, startupz string
+}{
+	livez:    server.DrainingPass,
+	readyz:   server.DrainingFail,
+	startupz: server.DrainingPass,
+}
+
+// loadHistoryFile parses the journal rotation size
+func loadHistoryFile() error {
+	size, err := server.ParseSize(historyFileMaxSize)
+	if err != nil {
+		return err
+	}
+	options.HistoryFileMaxSize = size
+	return nil
+}
+
+// loadProbes parses the draining behavior of each probe
+func loadProbes() error {
+	var err error
+	if options.LivezDraining, err = server.ParseDrainingBehavior(probeDraining.livez); err != nil {
+		return err
+	}
+	if options.ReadyzDraining, err = server.ParseDrainingBehavior(probeDraining.readyz); err != nil {
+		return err
+	}
+	options.StartupzDraining, err = server.ParseDrainingBehavior(probeDraining.startupz)
+	return err
+}
+
+// loadFaults collects fault profiles from the config file "faults" key and the --fault flags
+func loadFaults() error {
+	var profiles []server.FaultProfile
+	if err := viper.UnmarshalKey("faults", &profiles); err != nil {
+		return fmt.Errorf("unable to read faults from config: %v", err)
+	}
+	for i := range profiles {
+		if err := profiles[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, spec := range faultSpecs {
+		p, err := server.ParseFaultProfile(spec)
+		if err != nil {
+			return err
+		}
+		profiles = append(profiles, p)
+	}
+
+	options.Faults = profiles
+	return nil
 }
 
 func init() {
@@ -53,4 +130,26 @@ func init() {
 	// is called directly, e.g.:
 	serveCmd.Flags().IntVarP(&options.ListenPort, "port", "p", options.ListenPort, "The port the service will bind to.")
 	serveCmd.Flags().IntVarP(&options.ShutdownDelaySeconds, "shutdown-delay", "s", options.ShutdownDelaySeconds, "The amount of time in seconds to delay on shutdown. Useful for testing graceful termination.")
+	serveCmd.Flags().IntVar(&options.ShutdownTimeoutSeconds, "shutdown-timeout", options.ShutdownTimeoutSeconds, "The maximum time in seconds to wait for in-flight requests and connections after the shutdown delay. Remaining connections are closed forcibly. 0 waits indefinitely.")
+	serveCmd.Flags().StringVar(&options.TLSCertFile, "tls-cert", "", "Path to a PEM encoded certificate. When set with --tls-key the server will serve HTTPS.")
+	serveCmd.Flags().StringVar(&options.TLSKeyFile, "tls-key", "", "Path to the PEM encoded private key for --tls-cert.")
+	serveCmd.Flags().BoolVar(&options.TLSSelfSigned, "tls-self-signed", false, "Serve HTTPS using a self-signed certificate generated in memory at startup.")
+	serveCmd.Flags().IntVar(&options.GRPCPort, "grpc-port", 0, "If greater than 0, serve the grpc Echo and grpc.health.v1 services on this port.")
+	serveCmd.Flags().IntVar(&options.TCPEchoPort, "tcp-echo-port", 0, "If greater than 0, open a raw TCP echo listener on this port.")
+	serveCmd.Flags().IntVar(&options.UDPEchoPort, "udp-echo-port", 0, "If greater than 0, open a UDP echo listener on this port.")
+	serveCmd.Flags().StringVar(&probeDraining.livez, "livez-draining", probeDraining.livez, "How /livez responds while the server is draining: pass, fail or fail-after=N seconds.")
+	serveCmd.Flags().StringVar(&probeDraining.readyz, "readyz-draining", probeDraining.readyz, "How /readyz responds while the server is draining: pass, fail or fail-after=N seconds.")
+	serveCmd.Flags().StringVar(&probeDraining.startupz, "startupz-draining", probeDraining.startupz, "How /startupz responds while the server is draining: pass, fail or fail-after=N seconds.")
+	serveCmd.Flags().Float64Var(&options.SSERate, "sse-rate", 1, "Default number of events per second sent on /sse, can be overridden with the rate query parameter.")
+	serveCmd.Flags().IntVar(&options.HistorySize, "history-size", 0, "Number of recent requests kept in memory and served on /_history. Disabled when 0. /_history is served without authentication on --port, anyone who can reach the server can read the recorded requests. Credential headers are redacted, bodies are not.")
+	serveCmd.Flags().BoolVar(&options.HistoryExcludeProbes, "history-exclude-probes", true, "Leave /healthcheck, /livez, /readyz and /startupz requests out of /_history and the --history-file.")
+	serveCmd.Flags().StringVar(&options.HistoryFile, "history-file", "", "Append every response and lifecycle event to this JSON Lines file. Credential headers are redacted, bodies are not.")
+	serveCmd.Flags().StringVar(&historyFileMaxSize, "history-file-max-size", historyFileMaxSize, "Size at which the --history-file is rotated, e.g. 512KiB or 10MiB. Rotation is disabled when 0.")
+	serveCmd.Flags().IntVar(&options.HistoryFileMaxFiles, "history-file-max-files", 5, "Number of rotated --history-file files to keep.")
+	serveCmd.Flags().IntVar(&options.AdminPort, "admin-port", 0, "Port for the admin API used to change readiness, drain and fault settings at runtime. Disabled when 0.")
+	serveCmd.Flags().StringVar(&options.AdminAddress, "admin-address", "127.0.0.1", "Address the admin API binds to. The API is not authenticated, anyone who can reach it can drain the server, mark it unready or inject faults. Only use a wider address such as 0.0.0.0 on a trusted network.")
+	serveCmd.Flags().StringVar(&options.VersionLabel, "version-label", "", "A version reported in the server details of every response, e.g. the image tag. Lets clients tally traffic per release.")
+	serveCmd.Flags().StringArrayVar(&faultSpecs, "fault", nil, "A fault injection profile for a handler path, may be repeated. e.g. path=/,error-rate=0.05,error-status=500,hang-rate=0.01,hang=30s,latency=normal,latency-mean=100ms,latency-stddev=20ms")
+	serveCmd.Flags().BoolVar(&options.H2C, "h2c", false, "Accept HTTP/2 over cleartext connections, using prior knowledge or an h2c upgrade.")
+	serveCmd.Flags().StringVar(&options.TLSClientCAFile, "tls-client-ca", "", "Path to a PEM encoded CA bundle. When set, clients must present a certificate signed by one of these CAs (mutual TLS).")
 }
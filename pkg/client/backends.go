@@ -0,0 +1,175 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// echoedServer is the part of an echoed response that names the backend
+type echoedServer struct {
+	Server struct {
+		Hostname string `json:"hostname"`
+		Version  string `json:"version"`
+	} `json:"server"`
+}
+
+// backendCounts tallies responses per backend hostname and version label
+type backendCounts struct {
+	Hostnames map[string]int64 `json:"hostnames"`
+	Versions  map[string]int64 `json:"versions,omitempty"`
+}
+
+func newBackendCounts() *backendCounts {
+	return &backendCounts{Hostnames: map[string]int64{}, Versions: map[string]int64{}}
+}
+
+func (c *backendCounts) add(hostname, version string, n int64) {
+	c.Hostnames[hostname] += n
+	if len(version) > 0 {
+		c.Versions[version] += n
+	}
+}
+
+func (c *backendCounts) merge(other *backendCounts) {
+	for h, n := range other.Hostnames {
+		c.Hostnames[h] += n
+	}
+	for v, n := range other.Versions {
+		c.Versions[v] += n
+	}
+}
+
+// shares formats every count with its share of the total, e.g. "12 (40.0%)"
+func shares(counts map[string]int64) map[string]string {
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	s := make(map[string]string, len(counts))
+	for k, n := range counts {
+		s[k] = fmt.Sprintf("%d (%.1f%%)", n, 100*float64(n)/float64(total))
+	}
+	return s
+}
+
+// backendBucket holds the responses received in one second
+type backendBucket struct {
+	second int64
+	counts *backendCounts
+}
+
+// backends tallies the hostname and version label echoed by the server, for
+// the whole run and over the sliding --backend-windows, which the collector
+// logs every few seconds so traffic can be watched moving between releases
+type backends struct {
+	logger  logr.Logger
+	metrics *clientMetrics
+	windows []time.Duration
+
+	total   *backendCounts
+	buckets []backendBucket
+}
+
+func (o *Options) newBackends(logger logr.Logger) *backends {
+	return &backends{
+		logger:  logger.WithName("Backends"),
+		metrics: o.metrics,
+		windows: o.BackendWindows,
+		total:   newBackendCounts(),
+	}
+}
+
+func (b *backends) record(r *result) {
+	if len(r.body) == 0 || r.body[0] != '{' {
+		return
+	}
+	var echoed echoedServer
+	if err := json.Unmarshal(r.body, &echoed); err != nil || len(echoed.Server.Hostname) == 0 {
+		return
+	}
+	hostname, version := echoed.Server.Hostname, echoed.Server.Version
+
+	b.total.add(hostname, version, 1)
+	b.metrics.backendResponse(hostname, version)
+
+	if len(b.windows) == 0 {
+		return
+	}
+	now := time.Now()
+	second := now.Unix()
+	if n := len(b.buckets); n == 0 || b.buckets[n-1].second != second {
+		b.buckets = append(b.buckets, backendBucket{second: second, counts: newBackendCounts()})
+	}
+	b.buckets[len(b.buckets)-1].counts.add(hostname, version, 1)
+	b.prune(now)
+}
+
+// prune drops buckets older than the longest window
+func (b *backends) prune(now time.Time) {
+	var longest time.Duration
+	for _, w := range b.windows {
+		if w > longest {
+			longest = w
+		}
+	}
+	oldest := now.Add(-longest).Unix()
+	i := 0
+	for i < len(b.buckets) && b.buckets[i].second <= oldest {
+		i++
+	}
+	b.buckets = b.buckets[i:]
+}
+
+// window sums the buckets received within the last d
+func (b *backends) window(now time.Time, d time.Duration) *backendCounts {
+	counts := newBackendCounts()
+	oldest := now.Add(-d).Unix()
+	for i := len(b.buckets) - 1; i >= 0 && b.buckets[i].second > oldest; i-- {
+		counts.merge(b.buckets[i].counts)
+	}
+	return counts
+}
+
+// log writes the distribution over every window. It runs on a ticker rather
+// than per response, so a window emptied by failing requests still shows up.
+func (b *backends) log(now time.Time) {
+	if len(b.windows) == 0 || len(b.total.Hostnames) == 0 {
+		return
+	}
+	b.prune(now)
+	for _, w := range b.windows {
+		counts := b.window(now, w)
+		values := []interface{}{"window", w.String(), "hostnames", shares(counts.Hostnames)}
+		if len(counts.Versions) > 0 {
+			values = append(values, "versions", shares(counts.Versions))
+		}
+		b.logger.Info("backend distribution", values...)
+	}
+}
+
+// report returns the tally for the whole run, nil when no response named a backend
+func (b *backends) report() *backendCounts {
+	if len(b.total.Hostnames) == 0 {
+		return nil
+	}
+	return b.total
+}
+
+// sortedByCount orders the keys by descending count, then by name
+func sortedByCount(counts map[string]int64) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
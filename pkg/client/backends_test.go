@@ -0,0 +1,95 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	logtesting "github.com/go-logr/logr/testing"
+)
+
+func TestBackendsRecord(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		hostnames map[string]int64
+		versions  map[string]int64
+	}{
+		{name: "echoed", body: `{"server":{"hostname":"loqu-1","version":"0.0.2"}}`,
+			hostnames: map[string]int64{"loqu-1": 1}, versions: map[string]int64{"0.0.2": 1}},
+		{name: "no version label", body: `{"server":{"hostname":"loqu-1"}}`,
+			hostnames: map[string]int64{"loqu-1": 1}, versions: map[string]int64{}},
+		{name: "no hostname", body: `{"server":{}}`, hostnames: map[string]int64{}, versions: map[string]int64{}},
+		{name: "not json", body: "upstream connect error", hostnames: map[string]int64{}, versions: map[string]int64{}},
+		{name: "empty", hostnames: map[string]int64{}, versions: map[string]int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := (&Options{BackendWindows: []time.Duration{time.Minute}}).newBackends(logtesting.NullLogger{})
+			b.record(&result{body: []byte(tt.body)})
+			if !reflect.DeepEqual(b.total.Hostnames, tt.hostnames) || !reflect.DeepEqual(b.total.Versions, tt.versions) {
+				t.Errorf("total = %v %v, want %v %v", b.total.Hostnames, b.total.Versions, tt.hostnames, tt.versions)
+			}
+			if got := len(b.buckets); got != len(tt.hostnames) {
+				t.Errorf("got %d buckets, want %d", got, len(tt.hostnames))
+			}
+		})
+	}
+}
+
+func TestBackendsWindow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	bucket := func(ago int64, hostname string, n int64) backendBucket {
+		counts := newBackendCounts()
+		counts.add(hostname, "", n)
+		return backendBucket{second: now.Unix() - ago, counts: counts}
+	}
+	newBackends := func() *backends {
+		return &backends{
+			windows: []time.Duration{10 * time.Second, time.Minute},
+			total:   newBackendCounts(),
+			buckets: []backendBucket{bucket(90, "old", 7), bucket(30, "blue", 4), bucket(9, "blue", 1), bucket(0, "green", 2)},
+		}
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		d    time.Duration
+		want map[string]int64
+	}{
+		{name: "short window", now: now, d: 10 * time.Second, want: map[string]int64{"blue": 1, "green": 2}},
+		{name: "long window", now: now, d: time.Minute, want: map[string]int64{"blue": 5, "green": 2}},
+		{name: "everything", now: now, d: time.Hour, want: map[string]int64{"old": 7, "blue": 5, "green": 2}},
+		{name: "no responses lately", now: now.Add(time.Minute), d: 10 * time.Second, want: map[string]int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newBackends().window(tt.now, tt.d).Hostnames; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("window(%s) = %v, want %v", tt.d, got, tt.want)
+			}
+		})
+	}
+
+	pruneTests := []struct {
+		name    string
+		now     time.Time
+		seconds []int64
+	}{
+		{name: "drops buckets older than the longest window", now: now, seconds: []int64{970, 991, 1000}},
+		{name: "keeps nothing once every bucket expired", now: now.Add(2 * time.Minute), seconds: []int64{}},
+	}
+	for _, tt := range pruneTests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBackends()
+			b.prune(tt.now)
+			seconds := []int64{}
+			for _, bucket := range b.buckets {
+				seconds = append(seconds, bucket.second)
+			}
+			if !reflect.DeepEqual(seconds, tt.seconds) {
+				t.Errorf("buckets after prune = %v, want %v", seconds, tt.seconds)
+			}
+		})
+	}
+}
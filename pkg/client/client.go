@@ -2,10 +2,12 @@ package client
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
-	"net"
 	"net/http"
+	"net/http/httptrace"
 	"os"
 	"os/signal"
 	"time"
@@ -29,6 +31,46 @@ type Options struct {
 	IntervalSeconds int
 	Data            *string
 	ExitMode        bool
+
+	TLSCAFile             string
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSInsecureSkipVerify bool
+	TLSServerName         string
+	TLSMinVersion         string
+
+	HTTP2 bool
+	H2C   bool
+
+	UseGRPC    bool
+	GRPCMethod string
+
+	UseSSE bool
+
+	// Concurrency, Rate, Duration and Requests enable load mode, see load
+	Concurrency int
+	Rate        float64
+	Duration    time.Duration
+	Requests    int
+
+	// SummaryFormat is used for the end of run summary of http calls: table,
+	// json or none
+	SummaryFormat string
+
+	// Verdict judges a continuous run against MaxErrors failed requests and,
+	// when set, MaxDowntime for the longest window of consecutive failures
+	Verdict     bool
+	MaxErrors   int
+	MaxDowntime time.Duration
+
+	// BackendWindows are the sliding windows over which the backend hostname
+	// and version tally is logged, none disables the log
+	BackendWindows []time.Duration
+
+	// MetricsPort enables a Prometheus metrics listener when greater than 0
+	MetricsPort int
+
+	metrics *clientMetrics
 }
 
 func (o *Options) dataOrDefault(data fmt.Stringer) []byte {
@@ -44,51 +86,83 @@ func Run(o *Options) {
 	logger := glogr.New().WithName("Client")
 	logger.Info("Run called", "options", o)
 
-	if o.UseWebSocket {
-		o.dial(logger)
+	if o.HTTP2 && o.H2C {
+		logger.Error(nil, "--http2 and --h2c are mutually exclusive")
+		os.Exit(1)
+	}
+	switch o.SummaryFormat {
+	case SummaryTable, SummaryJSON, SummaryNone:
+	default:
+		logger.Error(nil, "unsupported summary format, expected one of table, json, none", "summary", o.SummaryFormat)
+		os.Exit(1)
+	}
+	if err := o.validateLoad(); err != nil {
+		logger.Error(err, "invalid load options")
+		os.Exit(1)
+	}
+	if err := o.validateVerdict(); err != nil {
+		logger.Error(err, "invalid verdict options")
+		os.Exit(1)
+	}
+	for _, w := range o.BackendWindows {
+		if w <= 0 {
+			logger.Error(nil, "backend windows must be positive durations", "window", w.String())
+			os.Exit(1)
+		}
+	}
+
+	if o.MetricsPort > 0 {
+		o.metrics = newClientMetrics()
+		o.metrics.serve(o.MetricsPort, logger)
+	}
+
+	tlsConfig, err := o.tlsConfig()
+	if err != nil {
+		logger.Error(err, "invalid TLS configuration")
+		os.Exit(1)
+	}
+
+	if o.UseGRPC {
+		o.callGRPC(logger, tlsConfig)
+	} else if o.UseSSE {
+		o.stream(logger, tlsConfig)
+	} else if o.UseWebSocket {
+		o.dial(logger, tlsConfig)
+	} else if o.loadMode() {
+		o.load(logger, tlsConfig)
 	} else {
-		o.postContinuously(logger)
+		o.postContinuously(logger, tlsConfig)
 	}
 }
 
-func (o *Options) postContinuously(logger logr.Logger) {
+func (o *Options) postContinuously(logger logr.Logger, tlsConfig *tls.Config) {
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 
-	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   time.Duration(o.TimeoutSeconds/2) * time.Second,
-			KeepAlive: 5 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		MaxIdleConns:          4,
-		MaxIdleConnsPerHost:   2,
-		IdleConnTimeout:       30 * time.Second,
-		TLSHandshakeTimeout:   1 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		// TODO: maybe expose with flag?
-		// DisableKeepAlives: true,
-	}
-
 	timeout := time.Duration(o.TimeoutSeconds) * time.Second
 	client := http.Client{
 		Timeout:   timeout,
-		Transport: transport,
+		Transport: o.transport(tlsConfig),
 	}
 
-	o.post(logger, &client)
+	c := o.newCollector(logger)
+	c.record(o.post(context.Background(), logger, &client))
 	if o.IntervalSeconds <= 0 {
 		return
 	}
+	defer c.finish(logger, o)
 
 	ticker := time.NewTicker(time.Duration(o.IntervalSeconds) * time.Second)
 	defer ticker.Stop()
+	progress := time.NewTicker(progressInterval)
+	defer progress.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			o.post(logger, &client)
+			c.record(o.post(context.Background(), logger, &client))
+		case t := <-progress.C:
+			c.tick(t)
 		case <-interrupt:
 			logger.Info("interupt")
 			return
@@ -96,41 +170,69 @@ func (o *Options) postContinuously(logger logr.Logger) {
 	}
 }
 
-func (o *Options) post(logger logr.Logger, client *http.Client) {
+// post sends a single request. ctx ends the request early, e.g. when a load
+// run is over.
+func (o *Options) post(ctx context.Context, logger logr.Logger, client *http.Client) *result {
 	url := fmt.Sprintf("%s://%s:%d/%s", o.Protocol, o.Host, o.Port, o.Path)
 	id := o.RequestID
 	if len(id) == 0 {
 		id = util.NewRequestID()
 	}
 	logger = logger.WithValues("requestID", id, "url", url)
-	logger.Info("post")
+	if o.verbose(logger) {
+		logger.Info("post")
+	}
+
+	res := &result{id: id, start: time.Now()}
+	res.timing = &timing{start: res.start}
+	defer o.metrics.record(o.Protocol, res)
 
-	req, err := http.NewRequest(o.Verb, url, bytes.NewBuffer(o.dataOrDefault(time.Now())))
+	req, err := http.NewRequestWithContext(ctx, o.Verb, url, bytes.NewBuffer(o.dataOrDefault(res.start)))
 	if err != nil {
+		res.fail(err)
 		o.handleError(logger, err, "failed to create new request")
-		return
+		return res
 	}
 	req.Header.Set(util.KeyRequestID, id)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), res.timing.trace()))
 
 	resp, err := client.Do(req)
 	if err != nil {
-		o.handleError(logger, err, "error sending http request")
-		return
+		res.timing.finish()
+		res.fail(err)
+		o.handleError(logger.WithValues(res.timing.values()...), err, "error sending http request")
+		return res
 	}
 
 	defer resp.Body.Close()
+	res.code = resp.StatusCode
 	body, err := ioutil.ReadAll(resp.Body)
+	res.timing.finish()
+	res.duration = time.Since(res.start)
 	if err != nil {
-		o.handleError(logger, err, "error reading response")
-		return
+		res.fail(err)
+		o.handleError(logger.WithValues(res.timing.values()...), err, "error reading response")
+		return res
+	}
+	res.body = body
+
+	if o.verbose(logger) {
+		values := append([]interface{}{"code", resp.StatusCode, "protocol", resp.Proto}, res.timing.values()...)
+		logger.Info("response received", append(values, tlsValues(resp.TLS)...)...)
+	}
+	if !o.loadMode() {
+		fmt.Println(string(body))
+	} else if logger.V(4).Enabled() {
+		logger.Info("response body", "body", string(body))
 	}
-	logger.Info("response received", "code", resp.StatusCode)
-	fmt.Println(string(body))
+	return res
 }
 
+// handleError logs the error and exits when --exit is set. In load mode the
+// workers stop the run instead, so the summary is still printed.
 func (o *Options) handleError(logger logr.Logger, err error, msg string) {
 	logger.Error(err, msg)
-	if o.ExitMode {
+	if o.ExitMode && !o.loadMode() {
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// maxWindowIDs limits the request IDs kept for each downtime window
+const maxWindowIDs = 10
+
+// downtimeWindow is a run of consecutive failed requests. It starts when the
+// earliest failed request was sent and ends when the first later successful
+// request was sent. A window still open when the run ends lasts until the last
+// failed request completed.
+type downtimeWindow struct {
+	Start      time.Time        `json:"start"`
+	End        time.Time        `json:"end"`
+	Duration   string           `json:"duration"`
+	Failures   int64            `json:"failures"`
+	ErrorTypes map[string]int64 `json:"errorTypes"`
+	RequestIDs []string         `json:"requestIDs"`
+
+	duration time.Duration
+}
+
+func (w *downtimeWindow) add(r *result) {
+	w.Failures++
+	w.ErrorTypes[failureType(r)]++
+	if len(w.RequestIDs) < maxWindowIDs {
+		w.RequestIDs = append(w.RequestIDs, r.id)
+	}
+	// concurrent workers can report a failure sent before the one that opened the window
+	if r.start.Before(w.Start) {
+		w.Start = r.start
+	}
+	if end := r.start.Add(r.duration); end.After(w.End) {
+		w.End = end
+	}
+	w.setEnd(w.End)
+}
+
+// setEnd sets the end of the window and updates its duration
+func (w *downtimeWindow) setEnd(end time.Time) {
+	w.End = end
+	w.duration = w.End.Sub(w.Start)
+	w.Duration = w.duration.Round(time.Millisecond).String()
+}
+
+// failureType is the error class of a failed request, or status_<code> when
+// the server answered with a non 2xx status
+func failureType(r *result) string {
+	if r.err != nil {
+		return r.class
+	}
+	return fmt.Sprintf("%s_%d", ErrorClassStatus, r.code)
+}
+
+// downtime tracks contiguous failure windows and judges the run against the
+// --max-errors and --max-downtime thresholds
+type downtime struct {
+	logger      logr.Logger
+	maxErrors   int64
+	maxDowntime time.Duration
+
+	failures int64
+	windows  []*downtimeWindow
+	current  *downtimeWindow
+}
+
+func (o *Options) validateVerdict() error {
+	switch {
+	case o.MaxErrors < 0, o.MaxDowntime < 0:
+		return fmt.Errorf("--max-errors and --max-downtime must not be negative")
+	case !o.Verdict:
+		return nil
+	case o.ExitMode:
+		return fmt.Errorf("--verdict cannot be combined with --exit")
+	case o.UseWebSocket || o.UseGRPC || o.UseSSE:
+		return fmt.Errorf("--verdict only applies to http requests")
+	case o.IntervalSeconds <= 0 && !o.loadMode():
+		return fmt.Errorf("--verdict needs a continuous run, use --interval or the load options")
+	}
+	return nil
+}
+
+func (o *Options) newDowntime(logger logr.Logger) *downtime {
+	return &downtime{
+		logger:      logger.WithName("Downtime"),
+		maxErrors:   int64(o.MaxErrors),
+		maxDowntime: o.MaxDowntime,
+	}
+}
+
+func (d *downtime) record(r *result) {
+	if !r.success() {
+		d.failures++
+		if d.current == nil {
+			d.current = &downtimeWindow{Start: r.start, End: r.start, ErrorTypes: map[string]int64{}}
+			d.windows = append(d.windows, d.current)
+			d.logger.Info("downtime started", "requestID", r.id, "errorType", failureType(r))
+		}
+		d.current.add(r)
+		return
+	}
+
+	// with concurrent workers a request sent before the window opened can
+	// still succeed after it, only a later request shows the service is back
+	if d.current != nil && !r.start.Before(d.current.Start) {
+		d.current.setEnd(r.start)
+		d.logger.Info("downtime ended", "duration", d.current.Duration, "failures", d.current.Failures, "errorTypes", d.current.ErrorTypes)
+		d.current = nil
+	}
+}
+
+// verdictReport is the outcome of a run judged against the thresholds
+type verdictReport struct {
+	Passed          bool              `json:"passed"`
+	Reasons         []string          `json:"reasons,omitempty"`
+	Failures        int64             `json:"failures"`
+	MaxErrors       int64             `json:"maxErrors"`
+	LongestWindow   string            `json:"longestWindow"`
+	MaxDowntime     string            `json:"maxDowntime"`
+	Windows         []*downtimeWindow `json:"windows"`
+	OngoingAtRunEnd bool              `json:"ongoingAtRunEnd"`
+}
+
+func (d *downtime) report() *verdictReport {
+	r := &verdictReport{
+		Failures:        d.failures,
+		MaxErrors:       d.maxErrors,
+		MaxDowntime:     d.maxDowntime.String(),
+		Windows:         d.windows,
+		OngoingAtRunEnd: d.current != nil,
+	}
+	if r.Windows == nil {
+		r.Windows = []*downtimeWindow{}
+	}
+	var longest time.Duration
+	for _, w := range d.windows {
+		if w.duration > longest {
+			longest = w.duration
+		}
+	}
+	r.LongestWindow = longest.Round(time.Millisecond).String()
+
+	if d.failures > d.maxErrors {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("%d failed requests, at most %d allowed", d.failures, d.maxErrors))
+	}
+	if d.maxDowntime > 0 && longest > d.maxDowntime {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("longest downtime window was %s, at most %s allowed", r.LongestWindow, d.maxDowntime))
+	}
+	r.Passed = len(r.Reasons) == 0
+	return r
+}
+
+func (r *verdictReport) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i, win := range r.Windows {
+		fmt.Fprintf(tw, "downtime %d\t%s - %s (%s), %d failed, %v\n", i+1,
+			win.Start.Format("15:04:05.000"), win.End.Format("15:04:05.000"), win.Duration, win.Failures, win.ErrorTypes)
+		fmt.Fprintf(tw, "\trequest IDs %v", win.RequestIDs)
+		if more := win.Failures - int64(len(win.RequestIDs)); more > 0 {
+			fmt.Fprintf(tw, " and %d more", more)
+		}
+		fmt.Fprintln(tw)
+	}
+	if r.OngoingAtRunEnd {
+		fmt.Fprintf(tw, "downtime ongoing\tthe last window was still open when the run ended\n")
+	}
+	verdict := "PASS"
+	if !r.Passed {
+		verdict = "FAIL"
+	}
+	fmt.Fprintf(tw, "verdict\t%s\n", verdict)
+	for _, reason := range r.Reasons {
+		fmt.Fprintf(tw, "\t%s\n", reason)
+	}
+	return tw.Flush()
+}
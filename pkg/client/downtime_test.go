@@ -0,0 +1,180 @@
+package client
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	logtesting "github.com/go-logr/logr/testing"
+)
+
+var downtimeStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// sent returns a result sent ms milliseconds into the run that took 10ms
+func sent(ms int, code int) *result {
+	r := &result{id: "r", start: downtimeStart.Add(time.Duration(ms) * time.Millisecond), duration: 10 * time.Millisecond, code: code}
+	if code == 0 {
+		r.fail(errors.New("connection refused"))
+	}
+	return r
+}
+
+func TestDowntimeWindows(t *testing.T) {
+	at := func(ms int) time.Time { return downtimeStart.Add(time.Duration(ms) * time.Millisecond) }
+
+	tests := []struct {
+		name       string
+		results    []*result
+		start, end []time.Time
+		errorTypes []map[string]int64
+		ongoing    bool
+	}{
+		{
+			name:    "no failures",
+			results: []*result{sent(0, 200), sent(100, 200)},
+		},
+		{
+			name:       "closed by the next success",
+			results:    []*result{sent(0, 200), sent(100, 503), sent(200, 0), sent(300, 200)},
+			start:      []time.Time{at(100)},
+			end:        []time.Time{at(300)},
+			errorTypes: []map[string]int64{{"status_503": 1, ErrorClassConnectionRefused: 1}},
+		},
+		{
+			name:       "two windows",
+			results:    []*result{sent(100, 500), sent(200, 200), sent(300, 500), sent(400, 500), sent(500, 204)},
+			start:      []time.Time{at(100), at(300)},
+			end:        []time.Time{at(200), at(500)},
+			errorTypes: []map[string]int64{{"status_500": 1}, {"status_500": 2}},
+		},
+		{
+			name:       "earlier failure reported late",
+			results:    []*result{sent(200, 503), sent(100, 503), sent(50, 200), sent(300, 200)},
+			start:      []time.Time{at(100)},
+			end:        []time.Time{at(300)},
+			errorTypes: []map[string]int64{{"status_503": 2}},
+		},
+		{
+			name:       "ongoing at run end",
+			results:    []*result{sent(0, 200), sent(100, 503), sent(200, 503)},
+			start:      []time.Time{at(100)},
+			end:        []time.Time{at(210)},
+			errorTypes: []map[string]int64{{"status_503": 2}},
+			ongoing:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := (&Options{Verdict: true}).newDowntime(logtesting.NullLogger{})
+			for _, r := range tt.results {
+				d.record(r)
+			}
+			report := d.report()
+			if len(report.Windows) != len(tt.start) {
+				t.Fatalf("got %d windows, want %d", len(report.Windows), len(tt.start))
+			}
+			for i, w := range report.Windows {
+				if !w.Start.Equal(tt.start[i]) || !w.End.Equal(tt.end[i]) {
+					t.Errorf("window %d = %s - %s, want %s - %s", i, w.Start, w.End, tt.start[i], tt.end[i])
+				}
+				if w.duration != w.End.Sub(w.Start) {
+					t.Errorf("window %d lasted %s, want %s", i, w.duration, w.End.Sub(w.Start))
+				}
+				for class, n := range tt.errorTypes[i] {
+					if w.ErrorTypes[class] != n {
+						t.Errorf("window %d error types = %v, want %v", i, w.ErrorTypes, tt.errorTypes[i])
+						break
+					}
+				}
+			}
+			if report.OngoingAtRunEnd != tt.ongoing {
+				t.Errorf("ongoingAtRunEnd = %v, want %v", report.OngoingAtRunEnd, tt.ongoing)
+			}
+		})
+	}
+}
+
+func TestDowntimeVerdict(t *testing.T) {
+	// two failures spanning a 200ms window
+	outage := []*result{sent(0, 200), sent(100, 503), sent(200, 503), sent(300, 200)}
+
+	tests := []struct {
+		name        string
+		maxErrors   int
+		maxDowntime time.Duration
+		results     []*result
+		passed      bool
+		reasons     []string
+	}{
+		{name: "clean run", results: []*result{sent(0, 200)}, passed: true},
+		{name: "no errors allowed", results: outage, reasons: []string{"2 failed requests, at most 0 allowed"}},
+		{name: "errors within budget, downtime not checked", maxErrors: 2, results: outage, passed: true},
+		{name: "downtime within budget", maxErrors: 2, maxDowntime: 200 * time.Millisecond, results: outage, passed: true},
+		{name: "downtime over budget", maxErrors: 2, maxDowntime: 150 * time.Millisecond, results: outage,
+			reasons: []string{"longest downtime window was 200ms, at most 150ms allowed"}},
+		{name: "both over budget", maxErrors: 1, maxDowntime: 100 * time.Millisecond, results: outage,
+			reasons: []string{"2 failed requests, at most 1 allowed", "longest downtime window was 200ms, at most 100ms allowed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := (&Options{Verdict: true, MaxErrors: tt.maxErrors, MaxDowntime: tt.maxDowntime}).newDowntime(logtesting.NullLogger{})
+			for _, r := range tt.results {
+				d.record(r)
+			}
+			report := d.report()
+			if report.Passed != tt.passed {
+				t.Errorf("passed = %v, want %v (reasons %v)", report.Passed, tt.passed, report.Reasons)
+			}
+			if strings.Join(report.Reasons, "; ") != strings.Join(tt.reasons, "; ") {
+				t.Errorf("reasons = %q, want %q", report.Reasons, tt.reasons)
+			}
+		})
+	}
+}
+
+func TestValidateVerdict(t *testing.T) {
+	tests := []struct {
+		name    string
+		o       Options
+		wantErr string
+	}{
+		{name: "verdict off", o: Options{}},
+		{name: "interval", o: Options{Verdict: true, IntervalSeconds: 1}},
+		{name: "load", o: Options{Verdict: true, Requests: 100}},
+		{name: "negative max errors", o: Options{MaxErrors: -1}, wantErr: "must not be negative"},
+		{name: "negative max downtime", o: Options{Verdict: true, IntervalSeconds: 1, MaxDowntime: -time.Second}, wantErr: "must not be negative"},
+		{name: "exit", o: Options{Verdict: true, IntervalSeconds: 1, ExitMode: true}, wantErr: "cannot be combined with --exit"},
+		{name: "exit without verdict", o: Options{IntervalSeconds: 1, ExitMode: true}},
+		{name: "grpc", o: Options{Verdict: true, IntervalSeconds: 1, UseGRPC: true}, wantErr: "only applies to http requests"},
+		{name: "single request", o: Options{Verdict: true}, wantErr: "needs a continuous run"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.o.validateVerdict()
+			switch {
+			case len(tt.wantErr) == 0 && err != nil:
+				t.Fatalf("validateVerdict() returned an error: %v", err)
+			case len(tt.wantErr) > 0 && err == nil:
+				t.Fatalf("validateVerdict() = nil, want an error containing %q", tt.wantErr)
+			case len(tt.wantErr) > 0 && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("validateVerdict() = %q, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerdictPrinted(t *testing.T) {
+	for _, format := range []string{SummaryTable, SummaryJSON, SummaryNone} {
+		t.Run(format, func(t *testing.T) {
+			report := &summaryReport{Verdict: &verdictReport{Reasons: []string{"2 failed requests, at most 0 allowed"}}}
+			var b strings.Builder
+			if err := report.print(&b, format); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(b.String(), "at most 0 allowed") {
+				t.Errorf("%s summary does not show the verdict:\n%s", format, b.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error classes used in metrics and reports
+const (
+	ErrorClassNone              = ""
+	ErrorClassTimeout           = "timeout"
+	ErrorClassConnectionRefused = "connection_refused"
+	ErrorClassConnectionReset   = "connection_reset"
+	ErrorClassEOF               = "eof"
+	ErrorClassTLS               = "tls"
+	ErrorClassDNS               = "dns"
+	ErrorClassCanceled          = "canceled"
+	ErrorClassStatus            = "status"
+	ErrorClassOther             = "other"
+)
+
+// errorClass groups an error into one of the error classes
+func errorClass(err error) string {
+	if err == nil {
+		return ErrorClassNone
+	}
+
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.DeadlineExceeded:
+			return ErrorClassTimeout
+		case codes.Canceled:
+			return ErrorClassCanceled
+		case codes.Unavailable:
+			// the transport error is only available as text
+			return errorClassFromMessage(s.Message())
+		}
+		return ErrorClassStatus
+	}
+
+	var (
+		dnsErr   *net.DNSError
+		netErr   net.Error
+		certErr  *tls.CertificateVerificationError
+		unknown  x509.UnknownAuthorityError
+		hostErr  x509.HostnameError
+		invalid  x509.CertificateInvalidError
+		recErr   tls.RecordHeaderError
+		alertErr tls.AlertError
+	)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.As(err, &dnsErr):
+		return ErrorClassDNS
+	case errors.As(err, &certErr), errors.As(err, &unknown), errors.As(err, &hostErr),
+		errors.As(err, &invalid), errors.As(err, &recErr), errors.As(err, &alertErr):
+		return ErrorClassTLS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorClassConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ErrorClassConnectionReset
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorClassEOF
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	}
+	return errorClassFromMessage(err.Error())
+}
+
+// errorClassFromMessage is the fallback for errors that have lost their type,
+// e.g. when they cross a grpc or http2 boundary
+func errorClassFromMessage(msg string) string {
+	msg = strings.ToLower(msg)
+	switch {
+	case strings.Contains(msg, "connection refused"):
+		return ErrorClassConnectionRefused
+	case strings.Contains(msg, "connection reset"), strings.Contains(msg, "broken pipe"):
+		return ErrorClassConnectionReset
+	case strings.Contains(msg, "timeout"), strings.Contains(msg, "deadline exceeded"):
+		return ErrorClassTimeout
+	case strings.Contains(msg, "tls"), strings.Contains(msg, "x509"), strings.Contains(msg, "certificate"):
+		return ErrorClassTLS
+	case strings.Contains(msg, "no such host"):
+		return ErrorClassDNS
+	case strings.Contains(msg, "eof"):
+		return ErrorClassEOF
+	}
+	return ErrorClassOther
+}
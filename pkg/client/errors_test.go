@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorClass(t *testing.T) {
+	urlError := func(err error) error {
+		return &url.Error{Op: "Post", URL: "http://localhost:8080/", Err: err}
+	}
+	dial := func(errno syscall.Errno) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: errno}}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "nil", err: nil, want: ErrorClassNone},
+		{name: "refused", err: urlError(dial(syscall.ECONNREFUSED)), want: ErrorClassConnectionRefused},
+		{name: "reset", err: urlError(dial(syscall.ECONNRESET)), want: ErrorClassConnectionReset},
+		{name: "broken pipe", err: urlError(dial(syscall.EPIPE)), want: ErrorClassConnectionReset},
+		{name: "eof", err: urlError(io.EOF), want: ErrorClassEOF},
+		{name: "unexpected eof", err: urlError(io.ErrUnexpectedEOF), want: ErrorClassEOF},
+		{name: "canceled", err: urlError(context.Canceled), want: ErrorClassCanceled},
+		{name: "deadline", err: urlError(context.DeadlineExceeded), want: ErrorClassTimeout},
+		{name: "dns", err: urlError(&net.DNSError{Err: "no such host", Name: "nope.invalid", IsNotFound: true}), want: ErrorClassDNS},
+		{name: "grpc deadline", err: status.Error(codes.DeadlineExceeded, "too slow"), want: ErrorClassTimeout},
+		{name: "grpc unavailable refused", err: status.Error(codes.Unavailable, "connection error: dial tcp: connect: connection refused"), want: ErrorClassConnectionRefused},
+		{name: "grpc internal", err: status.Error(codes.Internal, "boom"), want: ErrorClassStatus},
+		{name: "message only tls", err: fmt.Errorf("remote error: tls: handshake failure"), want: ErrorClassTLS},
+		{name: "unknown", err: errors.New("something else"), want: ErrorClassOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorClass(tt.err); got != tt.want {
+				t.Errorf("errorClass(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
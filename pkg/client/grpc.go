@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/aka-bo/loqu/pkg/api/echo"
+	"github.com/aka-bo/loqu/pkg/util"
+)
+
+// grpc methods supported by --grpc-method
+const (
+	GRPCUnary        = "unary"
+	GRPCServerStream = "server-stream"
+	GRPCBidi         = "bidi"
+)
+
+func (o *Options) callGRPC(logger logr.Logger, tlsConfig *tls.Config) {
+	addr := fmt.Sprintf("%s:%d", o.Host, o.Port)
+	logger = logger.WithValues("addr", addr, "method", o.GRPCMethod)
+
+	creds := insecure.NewCredentials()
+	if o.Protocol == "https" {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		o.handleError(logger, err, "failed to create grpc client")
+		return
+	}
+	defer conn.Close()
+	client := echo.NewEchoClient(conn)
+
+	switch o.GRPCMethod {
+	case GRPCUnary:
+		o.echoContinuously(logger, client)
+	case GRPCServerStream:
+		o.serverStream(logger, client)
+	case GRPCBidi:
+		o.bidiStream(logger, client)
+	default:
+		logger.Error(nil, "unsupported grpc method, expected one of unary, server-stream, bidi")
+		os.Exit(1)
+	}
+}
+
+func (o *Options) grpcContext(ctx context.Context) (context.Context, string) {
+	id := o.RequestID
+	if len(id) == 0 {
+		id = util.NewRequestID()
+	}
+	return metadata.AppendToOutgoingContext(ctx, util.KeyRequestID, id), id
+}
+
+func (o *Options) echoContinuously(logger logr.Logger, client echo.EchoClient) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	o.echo(logger, client)
+	if o.IntervalSeconds <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(o.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			o.echo(logger, client)
+		case <-interrupt:
+			logger.Info("interupt")
+			return
+		}
+	}
+}
+
+func (o *Options) echo(logger logr.Logger, client echo.EchoClient) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(o.TimeoutSeconds)*time.Second)
+	defer cancel()
+	ctx, id := o.grpcContext(ctx)
+	logger = logger.WithValues("requestID", id)
+	logger.Info("echo")
+
+	start := time.Now()
+	resp, err := client.Echo(ctx, &echo.EchoRequest{Message: string(o.dataOrDefault(time.Now()))})
+	o.metrics.request("grpc", status.Code(err).String(), err == nil, err, time.Since(start))
+	if err != nil {
+		o.handleError(logger.WithValues("code", status.Code(err).String()), err, "error sending grpc request")
+		return
+	}
+	logger.Info("response received", "code", status.Code(err).String())
+	printMessage(resp)
+}
+
+func (o *Options) serverStream(logger logr.Logger, client echo.EchoClient) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx, id := o.grpcContext(ctx)
+	logger = logger.WithValues("requestID", id)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		logger.Info("interrupt")
+		cancel()
+	}()
+
+	// a single message unless an interval was requested, in which case stream until the server stops
+	req := &echo.ServerStreamRequest{Message: string(o.dataOrDefault(time.Now())), Count: 1}
+	if o.IntervalSeconds > 0 {
+		req.Count = 0
+		req.Interval = durationpb.New(time.Duration(o.IntervalSeconds) * time.Second)
+	}
+
+	logger.Info("opening stream")
+	stream, err := client.ServerStream(ctx, req)
+	if err != nil {
+		o.handleError(logger, err, "failed to open stream")
+		return
+	}
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			logger.Info("stream closed")
+			return
+		}
+		if err != nil {
+			o.handleError(logger.WithValues("code", status.Code(err).String()), err, "stream ended with error")
+			return
+		}
+		logger.Info("message received", "sequence", resp.GetSequence())
+		printMessage(resp)
+	}
+}
+
+func (o *Options) bidiStream(logger logr.Logger, client echo.EchoClient) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx, id := o.grpcContext(ctx)
+	logger = logger.WithValues("requestID", id)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	logger.Info("opening stream")
+	stream, err := client.BidiStream(ctx)
+	if err != nil {
+		o.handleError(logger, err, "failed to open stream")
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF {
+				logger.Info("stream closed")
+				return
+			}
+			if err != nil {
+				o.handleError(logger.WithValues("code", status.Code(err).String()), err, "read error")
+				return
+			}
+			logger.Info("message received", "sequence", resp.GetSequence())
+			printMessage(resp)
+		}
+	}()
+
+	send := func(t time.Time) {
+		if err := stream.Send(&echo.EchoRequest{Message: string(o.dataOrDefault(t))}); err != nil {
+			logger.Error(err, "write error")
+		}
+	}
+
+	closeStream := func() {
+		if err := stream.CloseSend(); err != nil {
+			logger.Error(err, "error closing the stream")
+			return
+		}
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+		}
+	}
+
+	send(time.Now())
+	if o.IntervalSeconds <= 0 {
+		closeStream()
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(o.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case t := <-ticker.C:
+			send(t)
+		case <-interrupt:
+			logger.Info("interrupt")
+			closeStream()
+			return
+		}
+	}
+}
+
+func printMessage(resp *echo.EchoResponse) {
+	b, err := protojson.MarshalOptions{Multiline: true, Indent: "    "}.Marshal(resp)
+	if err != nil {
+		return
+	}
+	fmt.Println(string(b))
+}
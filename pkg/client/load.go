@@ -0,0 +1,195 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
+)
+
+const progressInterval = 5 * time.Second
+
+// loadMode reports whether requests are sent by concurrent workers instead of
+// one per interval
+func (o *Options) loadMode() bool {
+	return o.Concurrency > 1 || o.Rate > 0 || o.Duration > 0 || o.Requests > 0
+}
+
+func (o *Options) validateLoad() error {
+	switch {
+	case o.Concurrency < 0, o.Rate < 0, o.Duration < 0, o.Requests < 0:
+		return fmt.Errorf("--concurrency, --rate, --duration and --requests must not be negative")
+	case !o.loadMode():
+		return nil
+	case o.UseWebSocket || o.UseGRPC || o.UseSSE:
+		return fmt.Errorf("--concurrency, --rate, --duration and --requests only apply to http requests")
+	case o.IntervalSeconds > 0:
+		return fmt.Errorf("--interval cannot be combined with %s, use --rate to pace requests", strings.Join(o.loadFlags(), ", "))
+	}
+	return nil
+}
+
+// loadFlags names the load options that are set
+func (o *Options) loadFlags() []string {
+	var flags []string
+	if o.Concurrency > 1 {
+		flags = append(flags, "--concurrency")
+	}
+	if o.Rate > 0 {
+		flags = append(flags, "--rate")
+	}
+	if o.Duration > 0 {
+		flags = append(flags, "--duration")
+	}
+	if o.Requests > 0 {
+		flags = append(flags, "--requests")
+	}
+	return flags
+}
+
+// verbose reports whether every request should be logged. In load mode
+// per-request logs need -v=2.
+func (o *Options) verbose(logger logr.Logger) bool {
+	return !o.loadMode() || logger.V(2).Enabled()
+}
+
+// load sends requests from Concurrency workers, paced by a shared rate
+// limiter, until Duration has passed, Requests have been sent or the client is
+// interrupted. Without a limit it runs until interrupted.
+func (o *Options) load(logger logr.Logger, tlsConfig *tls.Config) {
+	workers := o.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	limit := rate.Inf
+	if o.Rate > 0 {
+		limit = rate.Limit(o.Rate)
+	}
+	limiter := rate.NewLimiter(limit, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if o.Duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, o.Duration)
+		defer cancel()
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			logger.Info("interupt")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	client := &http.Client{
+		Timeout:   time.Duration(o.TimeoutSeconds) * time.Second,
+		Transport: o.transport(tlsConfig),
+	}
+
+	progress := &progress{started: time.Now()}
+	c := o.newCollector(logger)
+	c.recorders = append(c.recorders, progress)
+	results := make(chan *result, workers)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case r, ok := <-results:
+				if !ok {
+					return
+				}
+				c.record(r)
+			case t := <-ticker.C:
+				progress.log(logger)
+				c.tick(t)
+			}
+		}
+	}()
+
+	logger.Info("starting load", "concurrency", workers, "rate", o.Rate, "duration", o.Duration.String(), "requests", o.Requests)
+
+	var issued int64
+	var exitRequested int32
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			workerLogger := logger.WithValues("worker", worker)
+			for {
+				if err := limiter.Wait(ctx); err != nil {
+					return
+				}
+				if o.Requests > 0 && atomic.AddInt64(&issued, 1) > int64(o.Requests) {
+					return
+				}
+				res := o.post(ctx, workerLogger, client)
+				if ctx.Err() != nil && errors.Is(res.err, ctx.Err()) {
+					// cut short by the end of the run, not by the server
+					if logger.V(2).Enabled() {
+						workerLogger.Info("request cancelled by the end of the run", "requestID", res.id)
+					}
+					return
+				}
+				results <- res
+				if res.err != nil && o.ExitMode {
+					atomic.StoreInt32(&exitRequested, 1)
+					cancel()
+					return
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(results)
+	<-done
+
+	progress.log(logger)
+	logger.Info("load finished", "elapsed", time.Since(progress.started).String())
+	c.finish(logger, o)
+	if atomic.LoadInt32(&exitRequested) == 1 {
+		logger.Info("stopped after a failed request because --exit is set")
+		os.Exit(1)
+	}
+}
+
+// progress counts results for the periodic progress log
+type progress struct {
+	started   time.Time
+	sent      int64
+	succeeded int64
+	failed    int64
+}
+
+func (p *progress) record(r *result) {
+	p.sent++
+	if r.success() {
+		p.succeeded++
+	} else {
+		p.failed++
+	}
+}
+
+func (p *progress) log(logger logr.Logger) {
+	elapsed := time.Since(p.started)
+	logger.Info("progress", "sent", p.sent, "succeeded", p.succeeded, "failed", p.failed,
+		"elapsed", elapsed.Round(time.Millisecond).String(), "rate", fmt.Sprintf("%.2f", float64(p.sent)/elapsed.Seconds()))
+}
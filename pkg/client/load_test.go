@@ -0,0 +1,39 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		o       Options
+		wantErr string
+	}{
+		{name: "single request", o: Options{}},
+		{name: "interval only", o: Options{IntervalSeconds: 1}},
+		{name: "load", o: Options{Concurrency: 4, Rate: 10, Duration: time.Minute, Requests: 100}},
+		{name: "negative rate", o: Options{Rate: -1}, wantErr: "must not be negative"},
+		{name: "negative requests", o: Options{Requests: -1}, wantErr: "must not be negative"},
+		{name: "websocket", o: Options{Concurrency: 2, UseWebSocket: true}, wantErr: "only apply to http requests"},
+		{name: "grpc", o: Options{Requests: 2, UseGRPC: true}, wantErr: "only apply to http requests"},
+		{name: "interval and rate", o: Options{IntervalSeconds: 1, Rate: 5}, wantErr: "--interval cannot be combined with --rate,"},
+		{name: "interval and concurrency", o: Options{IntervalSeconds: 1, Concurrency: 2}, wantErr: "--interval cannot be combined with --concurrency,"},
+		{name: "interval and limits", o: Options{IntervalSeconds: 1, Duration: time.Second, Requests: 5}, wantErr: "--interval cannot be combined with --duration, --requests,"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.o.validateLoad()
+			switch {
+			case len(tt.wantErr) == 0 && err != nil:
+				t.Fatalf("validateLoad() returned an error: %v", err)
+			case len(tt.wantErr) > 0 && err == nil:
+				t.Fatalf("validateLoad() = nil, want an error containing %q", tt.wantErr)
+			case len(tt.wantErr) > 0 && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("validateLoad() = %q, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
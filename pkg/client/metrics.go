@@ -0,0 +1,157 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "loqu_client"
+
+// Request results
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+// clientMetrics holds the Prometheus collectors served on --metrics-port. All
+// methods are safe to call on a nil clientMetrics.
+type clientMetrics struct {
+	registry *prometheus.Registry
+
+	requests            *prometheus.CounterVec
+	requestDuration     *prometheus.HistogramVec
+	websocketReconnects prometheus.Counter
+	websocketRoundTrip  prometheus.Histogram
+	websocketMessages   *prometheus.CounterVec
+	backendResponses    *prometheus.CounterVec
+}
+
+func newClientMetrics() *clientMetrics {
+	m := &clientMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "Number of requests sent, by protocol, result, status code and error class.",
+		}, []string{"protocol", "result", "code", "error_class"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "Time taken for requests to complete, by protocol and result.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2.5, 12),
+		}, []string{"protocol", "result"}),
+		websocketReconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "websocket_reconnects_total",
+			Help:      "Number of times the websocket connection was re-established.",
+		}),
+		websocketRoundTrip: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "websocket_round_trip_seconds",
+			Help:      "Time between sending a websocket message and receiving its echo.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2.5, 12),
+		}),
+		websocketMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "websocket_messages_total",
+			Help:      "Number of websocket messages, by direction.",
+		}, []string{"direction"}),
+		backendResponses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "backend_responses_total",
+			Help:      "Number of echoed http responses, by the server hostname and version label.",
+		}, []string{"hostname", "version"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.websocketReconnects,
+		m.websocketRoundTrip,
+		m.websocketMessages,
+		m.backendResponses,
+	)
+	return m
+}
+
+// serve starts the metrics listener on the given port
+func (m *clientMetrics) serve(port int, logger logr.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	addr := fmt.Sprintf(":%d", port)
+
+	go func() {
+		logger.Info("Starting metrics server", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logger.Error(err, "metrics server exited with error")
+		}
+	}()
+}
+
+// request records a completed request. code is the http or grpc status code,
+// empty when no response was received.
+func (m *clientMetrics) request(protocol, code string, success bool, err error, d time.Duration) {
+	if m == nil {
+		return
+	}
+	result := resultSuccess
+	if !success {
+		result = resultFailure
+	}
+	m.requests.WithLabelValues(protocol, result, code, errorClass(err)).Inc()
+	m.requestDuration.WithLabelValues(protocol, result).Observe(d.Seconds())
+}
+
+// record a completed http request
+func (m *clientMetrics) record(protocol string, r *result) {
+	if m == nil {
+		return
+	}
+	code := ""
+	if r.code > 0 {
+		code = strconv.Itoa(r.code)
+	}
+	m.request(protocol, code, r.success(), r.err, r.duration)
+}
+
+func (m *clientMetrics) websocketReconnect() {
+	if m == nil {
+		return
+	}
+	m.websocketReconnects.Inc()
+}
+
+func (m *clientMetrics) websocketMessage(direction string) {
+	if m == nil {
+		return
+	}
+	m.websocketMessages.WithLabelValues(direction).Inc()
+}
+
+func (m *clientMetrics) websocketRTT(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.websocketRoundTrip.Observe(d.Seconds())
+}
+
+func (m *clientMetrics) backendResponse(hostname, version string) {
+	if m == nil {
+		return
+	}
+	m.backendResponses.WithLabelValues(hostname, version).Inc()
+}
+
+// httpSuccess reports whether an http status code counts as a successful request
+func httpSuccess(code int) bool {
+	return code >= 200 && code < 300
+}
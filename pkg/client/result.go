@@ -0,0 +1,91 @@
+package client
+
+import (
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// result is the outcome of a single http request. In load mode every result
+// is passed to the recorders.
+type result struct {
+	id       string
+	start    time.Time
+	duration time.Duration
+	code     int
+	err      error
+	class    string
+	body     []byte
+	timing   *timing
+}
+
+func (r *result) fail(err error) {
+	if r.duration == 0 {
+		r.duration = time.Since(r.start)
+	}
+	r.err = err
+	r.class = errorClass(err)
+}
+
+func (r *result) success() bool {
+	return r.err == nil && httpSuccess(r.code)
+}
+
+// recorder consumes results. record is only ever called from one goroutine.
+type recorder interface {
+	record(r *result)
+}
+
+// collector passes every result to the recorders and reports on them once the
+// run ends
+type collector struct {
+	recorders []recorder
+	summary   *summary
+	downtime  *downtime
+	backends  *backends
+}
+
+func (o *Options) newCollector(logger logr.Logger) *collector {
+	c := &collector{summary: newSummary(), backends: o.newBackends(logger)}
+	c.recorders = append(c.recorders, c.summary, c.backends)
+	if o.Verdict {
+		c.downtime = o.newDowntime(logger)
+		c.recorders = append(c.recorders, c.downtime)
+	}
+	return c
+}
+
+func (c *collector) record(r *result) {
+	for _, rec := range c.recorders {
+		rec.record(r)
+	}
+}
+
+// tick logs the periodic reports, it is called every progressInterval from the
+// goroutine that records the results
+func (c *collector) tick(now time.Time) {
+	c.backends.log(now)
+}
+
+// finish prints the end of run reports. The process exits with 1 when the
+// run fails the downtime verdict.
+func (c *collector) finish(logger logr.Logger, o *Options) {
+	report := c.summary.report()
+	report.Backends = c.backends.report()
+	if c.downtime != nil {
+		report.Verdict = c.downtime.report()
+	}
+	if err := report.print(os.Stdout, o.SummaryFormat); err != nil {
+		logger.Error(err, "unable to print summary")
+	}
+
+	if v := report.Verdict; v != nil {
+		if v.Passed {
+			logger.Info("verdict passed", "failures", v.Failures, "windows", len(v.Windows), "longestWindow", v.LongestWindow)
+			return
+		}
+		logger.Error(nil, "verdict failed", "reasons", v.Reasons, "windows", len(v.Windows), "longestWindow", v.LongestWindow)
+		os.Exit(1)
+	}
+}
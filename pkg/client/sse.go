@@ -0,0 +1,242 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/aka-bo/loqu/pkg/server"
+	"github.com/aka-bo/loqu/pkg/util"
+)
+
+const (
+	defaultSSERetry = time.Second
+	maxReportedGaps = 100
+
+	// sseMissedAssumption is logged with the summary, the missed count is only
+	// as good as the server clocks
+	sseMissedAssumption = "missed events are derived from the server clock at the stream rate, counts across backends assume the same rate and synchronized clocks"
+)
+
+// sseGap is a run of sequence numbers that were never received
+type sseGap struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// sseConsumer reads a server-sent event stream, reconnecting with
+// Last-Event-ID whenever the stream ends, and keeps track of missed events
+type sseConsumer struct {
+	*Options
+	client *http.Client
+	logger logr.Logger
+
+	retry    time.Duration
+	lastSeq  int64
+	lastHost string
+	lastRate float64
+	lastAt   time.Time
+
+	events     int64
+	reconnects int64
+	missed     int64
+	gaps       []sseGap
+}
+
+// sseEvent is a single dispatched event
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+func (o *Options) stream(logger logr.Logger, tlsConfig *tls.Config) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-interrupt
+		logger.Info("interupt")
+		cancel()
+	}()
+
+	c := &sseConsumer{
+		Options: o,
+		client:  &http.Client{Transport: o.transport(tlsConfig)},
+		logger:  logger,
+		retry:   defaultSSERetry,
+	}
+
+	for {
+		c.connect(ctx)
+		if ctx.Err() != nil {
+			break
+		}
+
+		c.reconnects++
+		c.logger.Info("reconnecting", "retry", c.retry.String(), "lastEventID", c.lastSeq, "reconnects", c.reconnects)
+		select {
+		case <-time.After(c.retry):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	logger.Info("sse summary", "events", c.events, "reconnects", c.reconnects, "missed", c.missed, "gaps", c.gaps, "note", sseMissedAssumption)
+}
+
+// connect opens one stream and reads it until it ends
+func (c *sseConsumer) connect(ctx context.Context) {
+	u := url.URL{Scheme: c.Protocol, Host: fmt.Sprintf("%s:%d", c.Host, c.Port), Path: c.Path}
+	id := c.RequestID
+	if len(id) == 0 {
+		id = util.NewRequestID()
+	}
+	logger := c.logger.WithValues("requestID", id, "url", u.String())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		c.handleError(logger, err, "failed to create new request")
+		return
+	}
+	req.Header.Set(util.KeyRequestID, id)
+	req.Header.Set("Accept", "text/event-stream")
+	if c.lastSeq > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatInt(c.lastSeq, 10))
+	}
+
+	logger.Info("connecting", "lastEventID", c.lastSeq)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.handleError(logger, err, "error opening event stream")
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		c.handleError(logger, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body))), "error opening event stream")
+		return
+	}
+	logger.Info("stream opened", append([]interface{}{"code", resp.StatusCode, "protocol", resp.Proto}, tlsValues(resp.TLS)...)...)
+
+	var ev sseEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 {
+			c.dispatch(logger, ev)
+			ev = sseEvent{}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "id":
+			ev.id = value
+		case "event":
+			ev.event = value
+		case "data":
+			if len(ev.data) > 0 {
+				ev.data += "\n"
+			}
+			ev.data += value
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				c.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	switch err := scanner.Err(); {
+	case ctx.Err() != nil:
+	case err != nil:
+		c.handleError(logger, err, "event stream interrupted")
+	default:
+		logger.Info("stream ended by server")
+	}
+}
+
+func (c *sseConsumer) dispatch(logger logr.Logger, ev sseEvent) {
+	if len(ev.data) == 0 {
+		return
+	}
+
+	var data server.SSEEvent
+	if err := json.Unmarshal([]byte(ev.data), &data); err != nil {
+		logger.Error(err, "unable to parse event data", "data", ev.data)
+		return
+	}
+
+	if ev.event == "shutdown" {
+		logger.Info("server is shutting down the stream", "hostname", data.Hostname, "phase", data.Phase.String())
+		return
+	}
+
+	c.events++
+	seq, err := strconv.ParseInt(ev.id, 10, 64)
+	if err != nil {
+		logger.Error(err, "event has no valid id", "id", ev.id)
+		return
+	}
+
+	// sequence numbers are counted in intervals of the stream rate, they are
+	// only comparable between streams with the same rate
+	hostChanged := len(c.lastHost) > 0 && c.lastHost != data.Hostname
+	switch {
+	case c.lastSeq == 0:
+	case data.Rate != c.lastRate:
+		logger.Info("stream rate changed, missed events are not counted across the change",
+			"previousRate", c.lastRate, "rate", data.Rate, "sequence", seq, "lastEventID", c.lastSeq)
+	case seq > c.lastSeq+1:
+		gap := sseGap{From: c.lastSeq + 1, To: seq - 1}
+		missed := gap.To - gap.From + 1
+		c.missed += missed
+		if len(c.gaps) < maxReportedGaps {
+			c.gaps = append(c.gaps, gap)
+		}
+		logger.Info("gap detected", "missed", missed, "from", gap.From, "to", gap.To,
+			"duration", time.Since(c.lastAt).String(), "previousHostname", c.lastHost, "hostname", data.Hostname)
+	case seq <= c.lastSeq && hostChanged:
+		// a backend with a slower clock restarts the count, its events are new
+		logger.Info("sequence went back on a new backend, the server clocks differ",
+			"sequence", seq, "lastEventID", c.lastSeq, "previousHostname", c.lastHost, "hostname", data.Hostname)
+	case seq <= c.lastSeq:
+		logger.Info("duplicate or out of order event", "sequence", seq, "lastEventID", c.lastSeq)
+		return
+	}
+
+	if hostChanged {
+		logger.Info("backend changed", "previousHostname", c.lastHost, "hostname", data.Hostname)
+	}
+	c.lastSeq, c.lastHost, c.lastRate, c.lastAt = seq, data.Hostname, data.Rate, time.Now()
+
+	if logger.V(2).Enabled() {
+		logger.Info("event received", "sequence", seq, "hostname", data.Hostname, "phase", data.Phase.String())
+	}
+	fmt.Println(ev.data)
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+
+	logtesting "github.com/go-logr/logr/testing"
+
+	"github.com/aka-bo/loqu/pkg/server"
+)
+
+// received is an event as the consumer reads it off the stream
+type received struct {
+	seq      int64
+	hostname string
+	rate     float64
+	event    string
+}
+
+func (r received) sseEvent(t *testing.T) sseEvent {
+	b, err := json.Marshal(&server.SSEEvent{Hostname: r.hostname, Sequence: r.seq, Rate: r.rate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := sseEvent{event: r.event, data: string(b)}
+	if len(ev.event) == 0 {
+		ev.event = "message"
+		ev.id = strconv.FormatInt(r.seq, 10)
+	}
+	return ev
+}
+
+func TestSSEConsumerDispatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		events     []received
+		missed     int64
+		gaps       []sseGap
+		dispatched int64
+		lastSeq    int64
+		lastHost   string
+	}{
+		{
+			name:       "in order",
+			events:     []received{{seq: 10, hostname: "a", rate: 1}, {seq: 11, hostname: "a", rate: 1}, {seq: 12, hostname: "a", rate: 1}},
+			dispatched: 3, lastSeq: 12, lastHost: "a",
+		},
+		{
+			name:   "gap",
+			events: []received{{seq: 10, hostname: "a", rate: 1}, {seq: 13, hostname: "a", rate: 1}, {seq: 14, hostname: "a", rate: 1}},
+			missed: 2, gaps: []sseGap{{From: 11, To: 12}}, dispatched: 3, lastSeq: 14, lastHost: "a",
+		},
+		{
+			name:   "gap across a backend change",
+			events: []received{{seq: 10, hostname: "a", rate: 1}, {seq: 15, hostname: "b", rate: 1}},
+			missed: 4, gaps: []sseGap{{From: 11, To: 14}}, dispatched: 2, lastSeq: 15, lastHost: "b",
+		},
+		{
+			name:       "duplicate",
+			events:     []received{{seq: 10, hostname: "a", rate: 1}, {seq: 10, hostname: "a", rate: 1}, {seq: 11, hostname: "a", rate: 1}},
+			dispatched: 3, lastSeq: 11, lastHost: "a",
+		},
+		{
+			name:       "slower clock on a new backend",
+			events:     []received{{seq: 10, hostname: "a", rate: 1}, {seq: 8, hostname: "b", rate: 1}, {seq: 9, hostname: "b", rate: 1}},
+			dispatched: 3, lastSeq: 9, lastHost: "b",
+		},
+		{
+			name:   "rate changed",
+			events: []received{{seq: 10, hostname: "a", rate: 1}, {seq: 500, hostname: "a", rate: 50}, {seq: 502, hostname: "a", rate: 50}},
+			missed: 1, gaps: []sseGap{{From: 501, To: 501}}, dispatched: 3, lastSeq: 502, lastHost: "a",
+		},
+		{
+			name:       "rate lowered",
+			events:     []received{{seq: 500, hostname: "a", rate: 50}, {seq: 10, hostname: "a", rate: 1}},
+			dispatched: 2, lastSeq: 10, lastHost: "a",
+		},
+		{
+			name:       "shutdown event",
+			events:     []received{{seq: 10, hostname: "a", rate: 1}, {seq: 12, hostname: "a", rate: 1, event: "shutdown"}, {seq: 11, hostname: "a", rate: 1}},
+			dispatched: 2, lastSeq: 11, lastHost: "a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &sseConsumer{Options: &Options{}, logger: logtesting.NullLogger{}}
+			for _, r := range tt.events {
+				c.dispatch(c.logger, r.sseEvent(t))
+			}
+			if c.missed != tt.missed || !reflect.DeepEqual(c.gaps, tt.gaps) {
+				t.Errorf("missed %d in %v, want %d in %v", c.missed, c.gaps, tt.missed, tt.gaps)
+			}
+			if c.events != tt.dispatched || c.lastSeq != tt.lastSeq || c.lastHost != tt.lastHost {
+				t.Errorf("events %d, last %d from %q, want %d, last %d from %q", c.events, c.lastSeq, c.lastHost, tt.dispatched, tt.lastSeq, tt.lastHost)
+			}
+		})
+	}
+
+	t.Run("reported gaps are capped", func(t *testing.T) {
+		c := &sseConsumer{Options: &Options{}, logger: logtesting.NullLogger{}}
+		for i := int64(0); i <= maxReportedGaps+5; i++ {
+			c.dispatch(c.logger, received{seq: 1 + 2*i, hostname: "a", rate: 1}.sseEvent(t))
+		}
+		if len(c.gaps) != maxReportedGaps || c.missed != maxReportedGaps+5 {
+			t.Errorf("%d gaps reported, %d missed, want %d and %d", len(c.gaps), c.missed, maxReportedGaps, maxReportedGaps+5)
+		}
+	})
+}
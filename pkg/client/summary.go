@@ -0,0 +1,266 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Summary formats supported by --summary
+const (
+	SummaryTable = "table"
+	SummaryJSON  = "json"
+	SummaryNone  = "none"
+)
+
+// summary tallies every result for the end of run report
+type summary struct {
+	started      time.Time
+	requests     int64
+	succeeded    int64
+	statusCodes  map[int]int64
+	errorClasses map[string]int64
+	latencies    latencyHistogram
+	connections  connectionReport
+}
+
+func newSummary() *summary {
+	return &summary{
+		started:      time.Now(),
+		statusCodes:  map[int]int64{},
+		errorClasses: map[string]int64{},
+	}
+}
+
+func (s *summary) record(r *result) {
+	s.requests++
+	if r.success() {
+		s.succeeded++
+	}
+	if r.code > 0 {
+		s.statusCodes[r.code]++
+	}
+	if r.err != nil {
+		s.errorClasses[r.class]++
+	}
+	s.latencies.record(r.duration)
+
+	if r.timing == nil {
+		return
+	}
+	connected, reused := r.timing.connection()
+	switch {
+	case !connected:
+		s.connections.None++
+	case reused:
+		s.connections.Reused++
+		if !r.success() {
+			s.connections.ReusedFailed++
+		}
+	default:
+		s.connections.New++
+		if !r.success() {
+			s.connections.NewFailed++
+		}
+	}
+}
+
+// connectionReport counts requests by the connection they were sent on, so
+// failures on stale pooled connections can be told apart from failed dials
+type connectionReport struct {
+	New          int64 `json:"new"`
+	NewFailed    int64 `json:"newFailed"`
+	Reused       int64 `json:"reused"`
+	ReusedFailed int64 `json:"reusedFailed"`
+	None         int64 `json:"none"`
+}
+
+// summaryReport is the printed form of a summary
+type summaryReport struct {
+	Requests     int64            `json:"requests"`
+	Succeeded    int64            `json:"succeeded"`
+	Failed       int64            `json:"failed"`
+	SuccessRate  float64          `json:"successRate"`
+	Elapsed      string           `json:"elapsed"`
+	StatusCodes  map[string]int64 `json:"statusCodes"`
+	ErrorClasses map[string]int64 `json:"errorClasses"`
+	Latency      latencyReport    `json:"latency"`
+	Connections  connectionReport `json:"connections"`
+	Backends     *backendCounts   `json:"backends,omitempty"`
+	Verdict      *verdictReport   `json:"verdict,omitempty"`
+}
+
+// latencyReport holds latency percentiles in milliseconds
+type latencyReport struct {
+	P50  float64 `json:"p50Ms"`
+	P90  float64 `json:"p90Ms"`
+	P99  float64 `json:"p99Ms"`
+	Max  float64 `json:"maxMs"`
+	Mean float64 `json:"meanMs"`
+}
+
+func (s *summary) report() *summaryReport {
+	r := &summaryReport{
+		Requests:     s.requests,
+		Succeeded:    s.succeeded,
+		Failed:       s.requests - s.succeeded,
+		Elapsed:      time.Since(s.started).Round(time.Millisecond).String(),
+		StatusCodes:  map[string]int64{},
+		ErrorClasses: s.errorClasses,
+		Connections:  s.connections,
+	}
+	if s.requests > 0 {
+		r.SuccessRate = float64(s.succeeded) / float64(s.requests)
+	}
+	for code, n := range s.statusCodes {
+		r.StatusCodes[strconv.Itoa(code)] = n
+	}
+
+	if h := &s.latencies; h.count > 0 {
+		r.Latency = latencyReport{
+			P50:  milliseconds(h.percentile(50)),
+			P90:  milliseconds(h.percentile(90)),
+			P99:  milliseconds(h.percentile(99)),
+			Max:  milliseconds(h.max),
+			Mean: milliseconds(h.total / time.Duration(h.count)),
+		}
+	}
+	return r
+}
+
+// Latency histogram buckets grow by 2^(1/16), about 4.4%, from 1µs up to
+// 2^40µs, which is far longer than any request timeout
+const (
+	histogramSubBuckets = 16
+	histogramBuckets    = 40 * histogramSubBuckets
+)
+
+// latencyHistogram counts latencies in logarithmic buckets so the
+// percentiles of a long run take a fixed amount of memory. The count, total
+// and max are exact.
+type latencyHistogram struct {
+	counts [histogramBuckets + 1]int64
+	count  int64
+	total  time.Duration
+	max    time.Duration
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	h.counts[latencyBucket(d)]++
+	h.count++
+	h.total += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// latencyBucket returns the first bucket whose upper bound is at least d
+func latencyBucket(d time.Duration) int {
+	us := float64(d) / float64(time.Microsecond)
+	if us <= 1 {
+		return 0
+	}
+	i := int(math.Ceil(math.Log2(us) * histogramSubBuckets))
+	if i > histogramBuckets {
+		return histogramBuckets
+	}
+	return i
+}
+
+func bucketUpperBound(i int) time.Duration {
+	return time.Duration(math.Exp2(float64(i)/histogramSubBuckets) * float64(time.Microsecond))
+}
+
+// percentile uses the nearest rank method and returns the upper bound of the
+// bucket holding that rank, never more than the largest latency seen
+func (h *latencyHistogram) percentile(p int) time.Duration {
+	rank := (int64(p)*h.count + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			// the last bucket also holds everything beyond its bound
+			if upper := bucketUpperBound(i); i < histogramBuckets && upper < h.max {
+				return upper
+			}
+			break
+		}
+	}
+	return h.max
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// print writes the report in the given format
+func (r *summaryReport) print(w io.Writer, format string) error {
+	switch format {
+	case SummaryNone:
+		// the verdict decides the exit code, so it is shown even without a summary
+		if r.Verdict != nil {
+			return r.Verdict.print(w)
+		}
+		return nil
+	case SummaryJSON:
+		b, err := json.MarshalIndent(r, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "requests\t%d\n", r.Requests)
+	fmt.Fprintf(tw, "succeeded\t%d\n", r.Succeeded)
+	fmt.Fprintf(tw, "failed\t%d\n", r.Failed)
+	fmt.Fprintf(tw, "success rate\t%.2f%%\n", r.SuccessRate*100)
+	fmt.Fprintf(tw, "elapsed\t%s\n", r.Elapsed)
+	fmt.Fprintf(tw, "latency p50\t%.2fms\n", r.Latency.P50)
+	fmt.Fprintf(tw, "latency p90\t%.2fms\n", r.Latency.P90)
+	fmt.Fprintf(tw, "latency p99\t%.2fms\n", r.Latency.P99)
+	fmt.Fprintf(tw, "latency max\t%.2fms\n", r.Latency.Max)
+	fmt.Fprintf(tw, "new connections\t%d (%d failed)\n", r.Connections.New, r.Connections.NewFailed)
+	fmt.Fprintf(tw, "reused connections\t%d (%d failed)\n", r.Connections.Reused, r.Connections.ReusedFailed)
+	fmt.Fprintf(tw, "no connection\t%d\n", r.Connections.None)
+	for _, code := range sortedKeys(r.StatusCodes) {
+		fmt.Fprintf(tw, "status %s\t%d\n", code, r.StatusCodes[code])
+	}
+	for _, class := range sortedKeys(r.ErrorClasses) {
+		fmt.Fprintf(tw, "error %s\t%d\n", class, r.ErrorClasses[class])
+	}
+	if r.Backends != nil {
+		hostnames, versions := shares(r.Backends.Hostnames), shares(r.Backends.Versions)
+		for _, h := range sortedByCount(r.Backends.Hostnames) {
+			fmt.Fprintf(tw, "backend %s\t%s\n", h, hostnames[h])
+		}
+		for _, v := range sortedByCount(r.Backends.Versions) {
+			fmt.Fprintf(tw, "version %s\t%s\n", v, versions[v])
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if r.Verdict != nil {
+		return r.Verdict.print(w)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
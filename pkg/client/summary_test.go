@@ -0,0 +1,87 @@
+package client
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogramPercentiles(t *testing.T) {
+	var h latencyHistogram
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+
+	tests := []struct {
+		p    int
+		want time.Duration
+	}{
+		{p: 1, want: 10 * time.Millisecond},
+		{p: 50, want: 500 * time.Millisecond},
+		{p: 90, want: 900 * time.Millisecond},
+		{p: 99, want: 990 * time.Millisecond},
+		{p: 100, want: time.Second},
+	}
+	for _, tt := range tests {
+		got := h.percentile(tt.p)
+		// a bucket is about 4.4% wide and percentiles report its upper bound
+		if got < tt.want || float64(got) > float64(tt.want)*1.045 {
+			t.Errorf("percentile(%d) = %s, want %s within one bucket", tt.p, got, tt.want)
+		}
+	}
+	if h.max != time.Second {
+		t.Errorf("max = %s, want 1s", h.max)
+	}
+}
+
+func TestLatencyHistogramBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		d    time.Duration
+	}{
+		{name: "zero", d: 0},
+		{name: "sub microsecond", d: 500 * time.Nanosecond},
+		{name: "one hour", d: time.Hour},
+		{name: "beyond the last bucket", d: math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h latencyHistogram
+			h.record(tt.d)
+			if got := h.percentile(50); got != tt.d {
+				t.Errorf("percentile(50) of a single %s = %s", tt.d, got)
+			}
+		})
+	}
+}
+
+func TestSummaryReport(t *testing.T) {
+	s := newSummary()
+	results := []*result{
+		{code: 200, duration: 10 * time.Millisecond},
+		{code: 200, duration: 20 * time.Millisecond},
+		{code: 503, duration: 30 * time.Millisecond},
+		{duration: 40 * time.Millisecond, err: errors.New("connection refused"), class: ErrorClassConnectionRefused},
+	}
+	for _, r := range results {
+		s.record(r)
+	}
+
+	r := s.report()
+	if r.Requests != 4 || r.Succeeded != 2 || r.Failed != 2 {
+		t.Errorf("requests/succeeded/failed = %d/%d/%d, want 4/2/2", r.Requests, r.Succeeded, r.Failed)
+	}
+	if r.SuccessRate != 0.5 {
+		t.Errorf("success rate = %v, want 0.5", r.SuccessRate)
+	}
+	if r.StatusCodes["200"] != 2 || r.StatusCodes["503"] != 1 {
+		t.Errorf("status codes = %v", r.StatusCodes)
+	}
+	if r.ErrorClasses[ErrorClassConnectionRefused] != 1 {
+		t.Errorf("error classes = %v", r.ErrorClasses)
+	}
+	if r.Latency.Mean != 25 || r.Latency.Max != 40 {
+		t.Errorf("mean/max = %v/%v, want 25/40", r.Latency.Mean, r.Latency.Max)
+	}
+}
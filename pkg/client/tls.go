@@ -0,0 +1,76 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsConfig builds the client TLS configuration used for both https and wss
+func (o *Options) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         o.TLSServerName,
+		InsecureSkipVerify: o.TLSInsecureSkipVerify,
+	}
+
+	if len(o.TLSMinVersion) > 0 {
+		v, ok := tlsVersions[o.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported minimum TLS version %q, expected one of 1.0, 1.1, 1.2, 1.3", o.TLSMinVersion)
+		}
+		config.MinVersion = v
+	}
+
+	if len(o.TLSCAFile) > 0 {
+		b, err := ioutil.ReadFile(o.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in %s", o.TLSCAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if len(o.TLSCertFile) > 0 || len(o.TLSKeyFile) > 0 {
+		if len(o.TLSCertFile) == 0 || len(o.TLSKeyFile) == 0 {
+			return nil, fmt.Errorf("both a client certificate and key must be provided")
+		}
+		cert, err := tls.LoadX509KeyPair(o.TLSCertFile, o.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// tlsValues returns log key/value pairs describing the negotiated connection
+func tlsValues(state *tls.ConnectionState) []interface{} {
+	if state == nil {
+		return nil
+	}
+	return []interface{}{
+		"tlsVersion", tls.VersionName(state.Version),
+		"peerCertificates", peerChainSummary(state.PeerCertificates),
+	}
+}
+
+func peerChainSummary(certs []*x509.Certificate) []string {
+	summary := make([]string, 0, len(certs))
+	for _, c := range certs {
+		summary = append(summary, fmt.Sprintf("subject=%q issuer=%q notAfter=%s", c.Subject.String(), c.Issuer.String(), c.NotAfter.Format(time.RFC3339)))
+	}
+	return summary
+}
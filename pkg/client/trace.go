@@ -0,0 +1,122 @@
+package client
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// timing records the phases of a single http request with httptrace
+type timing struct {
+	mu sync.Mutex
+
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	firstByte    time.Time
+	end          time.Time
+
+	connected  bool
+	reused     bool
+	wasIdle    bool
+	idleTime   time.Duration
+	remoteAddr string
+}
+
+// trace returns the hooks that fill in the timing
+func (t *timing) trace() *httptrace.ClientTrace {
+	now := func(f func()) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		f()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { now(func() { t.dnsStart = time.Now() }) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { now(func() { t.dnsDone = time.Now() }) },
+		ConnectStart: func(string, string) {
+			now(func() {
+				if t.connectStart.IsZero() {
+					t.connectStart = time.Now()
+				}
+			})
+		},
+		ConnectDone:       func(string, string, error) { now(func() { t.connectDone = time.Now() }) },
+		TLSHandshakeStart: func() { now(func() { t.tlsStart = time.Now() }) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { now(func() { t.tlsDone = time.Now() }) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			now(func() {
+				t.gotConn = time.Now()
+				t.connected = true
+				// Newer transports can hand a freshly dialed connection over
+				// through the idle pool, so a dial seen by this request wins
+				t.reused = info.Reused && t.connectStart.IsZero()
+				t.wasIdle = info.WasIdle
+				t.idleTime = info.IdleTime
+				if info.Conn != nil {
+					t.remoteAddr = info.Conn.RemoteAddr().String()
+				}
+			})
+		},
+		GotFirstResponseByte: func() { now(func() { t.firstByte = time.Now() }) },
+	}
+}
+
+// finish marks the end of the request
+func (t *timing) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.end.IsZero() {
+		t.end = time.Now()
+	}
+}
+
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// phases returns the time spent in each phase, zero for phases that did not happen
+func (t *timing) phases() (dns, connect, tlsHandshake, ttfb, total time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return between(t.dnsStart, t.dnsDone), between(t.connectStart, t.connectDone),
+		between(t.tlsStart, t.tlsDone), between(t.start, t.firstByte), between(t.start, t.end)
+}
+
+// connection reports whether a connection was obtained and whether it came from the pool
+func (t *timing) connection() (connected, reused bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.connected, t.reused
+}
+
+// values returns key/value pairs for logging
+func (t *timing) values() []interface{} {
+	dns, connect, tlsHandshake, ttfb, total := t.phases()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	values := []interface{}{
+		"dns", dns.String(),
+		"connect", connect.String(),
+		"tlsHandshake", tlsHandshake.String(),
+		"ttfb", ttfb.String(),
+		"total", total.String(),
+	}
+	if !t.connected {
+		return append(values, "connection", "none")
+	}
+	values = append(values, "reused", t.reused, "remoteAddr", t.remoteAddr)
+	if t.wasIdle {
+		values = append(values, "idleTime", t.idleTime.String())
+	}
+	return values
+}
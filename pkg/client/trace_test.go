@@ -0,0 +1,76 @@
+package client
+
+import (
+	"net/http/httptrace"
+	"testing"
+	"time"
+)
+
+func TestTimingPhases(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	tests := []struct {
+		name                                    string
+		timing                                  *timing
+		dns, connect, tlsHandshake, ttfb, total time.Duration
+	}{
+		{
+			name: "fresh tls connection",
+			timing: &timing{start: start, dnsStart: at(1), dnsDone: at(3), connectStart: at(3), connectDone: at(8),
+				tlsStart: at(8), tlsDone: at(20), firstByte: at(30), end: at(35)},
+			dns: 2 * time.Millisecond, connect: 5 * time.Millisecond, tlsHandshake: 12 * time.Millisecond,
+			ttfb: 30 * time.Millisecond, total: 35 * time.Millisecond,
+		},
+		{
+			name:   "reused connection",
+			timing: &timing{start: start, firstByte: at(4), end: at(5)},
+			ttfb:   4 * time.Millisecond, total: 5 * time.Millisecond,
+		},
+		{
+			name:   "dial failed",
+			timing: &timing{start: start, connectStart: at(1), end: at(2)},
+			total:  2 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dns, connect, tlsHandshake, ttfb, total := tt.timing.phases()
+			if dns != tt.dns || connect != tt.connect || tlsHandshake != tt.tlsHandshake || ttfb != tt.ttfb || total != tt.total {
+				t.Errorf("phases() = %s %s %s %s %s, want %s %s %s %s %s", dns, connect, tlsHandshake, ttfb, total,
+					tt.dns, tt.connect, tt.tlsHandshake, tt.ttfb, tt.total)
+			}
+		})
+	}
+}
+
+func TestTimingConnection(t *testing.T) {
+	tests := []struct {
+		name      string
+		dial      bool
+		info      *httptrace.GotConnInfo
+		connected bool
+		reused    bool
+	}{
+		{name: "no connection"},
+		{name: "dialed", dial: true, info: &httptrace.GotConnInfo{}, connected: true},
+		{name: "from the pool", info: &httptrace.GotConnInfo{Reused: true}, connected: true, reused: true},
+		{name: "dialed and handed over through the pool", dial: true, info: &httptrace.GotConnInfo{Reused: true}, connected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timing := &timing{start: time.Now()}
+			trace := timing.trace()
+			if tt.dial {
+				trace.ConnectStart("tcp", "127.0.0.1:8080")
+				trace.ConnectDone("tcp", "127.0.0.1:8080", nil)
+			}
+			if tt.info != nil {
+				trace.GotConn(*tt.info)
+			}
+			if connected, reused := timing.connection(); connected != tt.connected || reused != tt.reused {
+				t.Errorf("connection() = %v, %v, want %v, %v", connected, reused, tt.connected, tt.reused)
+			}
+		})
+	}
+}
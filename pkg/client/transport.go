@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// transport builds the round tripper used for http requests. HTTP2 forces
+// HTTP/2 over TLS (negotiated with ALPN), H2C uses HTTP/2 with prior knowledge
+// over a cleartext connection. Otherwise HTTP/1.1 is used.
+func (o *Options) transport(tlsConfig *tls.Config) http.RoundTripper {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(o.TimeoutSeconds/2) * time.Second,
+		KeepAlive: 5 * time.Second,
+	}
+
+	idlePerHost := 2
+	if o.Concurrency > idlePerHost {
+		idlePerHost = o.Concurrency
+	}
+
+	switch {
+	case o.H2C:
+		return &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			ReadIdleTimeout: 30 * time.Second,
+		}
+	case o.HTTP2:
+		return &http2.Transport{
+			TLSClientConfig: tlsConfig,
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				td := &tls.Dialer{NetDialer: dialer, Config: cfg}
+				return td.DialContext(ctx, network, addr)
+			},
+			ReadIdleTimeout: 30 * time.Second,
+		}
+	}
+
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          2 * idlePerHost,
+		MaxIdleConnsPerHost:   idlePerHost,
+		IdleConnTimeout:       30 * time.Second,
+		TLSHandshakeTimeout:   1 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+		// TODO: maybe expose with flag?
+		// DisableKeepAlives: true,
+	}
+}
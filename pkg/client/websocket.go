@@ -1,11 +1,14 @@
 package client
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -14,25 +17,76 @@ import (
 	"github.com/aka-bo/loqu/pkg/util"
 )
 
-func (o *Options) dial(logger logr.Logger) {
-	id := util.NewRequestID()
-
+func (o *Options) dial(logger logr.Logger, tlsConfig *tls.Config) {
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 
+	// with an interval the connection is re-established whenever it is lost
+	for reconnect := false; ; reconnect = true {
+		if !o.connect(logger, tlsConfig, interrupt, reconnect) || o.IntervalSeconds <= 0 {
+			return
+		}
+
+		logger.Info("connection lost, reconnecting")
+		select {
+		case <-time.After(time.Second):
+		case <-interrupt:
+			logger.Info("interrupt")
+			return
+		}
+	}
+}
+
+// connect opens a websocket and writes to it until it is closed. It returns
+// false if the client was interrupted.
+func (o *Options) connect(logger logr.Logger, tlsConfig *tls.Config, interrupt <-chan os.Signal, reconnect bool) bool {
+	id := util.NewRequestID()
+
 	addr := fmt.Sprintf("%s:%d", o.Host, o.Port)
-	u := url.URL{Scheme: "ws", Host: addr, Path: "/echo"}
+	scheme := "ws"
+	if o.Protocol == "https" || o.Protocol == "wss" {
+		scheme = "wss"
+	}
+	u := url.URL{Scheme: scheme, Host: addr, Path: "/echo"}
 	logger = logger.WithValues("requestID", id, "url", u.String())
 	logger.Info("connecting to url")
 
 	headers := http.Header{
 		util.KeyRequestID: []string{id},
 	}
-	c, _, err := websocket.DefaultDialer.Dial(u.String(), headers)
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: time.Duration(o.TimeoutSeconds) * time.Second,
+		TLSClientConfig:  tlsConfig,
+	}
+	start := time.Now()
+	c, resp, err := dialer.Dial(u.String(), headers)
 	if err != nil {
+		code := ""
+		if resp != nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		o.metrics.request(scheme, code, false, err, time.Since(start))
 		logger.Error(err, "failed to connect to url")
+		return true
 	}
 	defer c.Close()
+	o.metrics.request(scheme, strconv.Itoa(resp.StatusCode), true, nil, time.Since(start))
+	if reconnect {
+		o.metrics.websocketReconnect()
+	}
+
+	var state *tls.ConnectionState
+	if tc, ok := c.UnderlyingConn().(*tls.Conn); ok {
+		s := tc.ConnectionState()
+		state = &s
+	}
+	logger.Info("connected", tlsValues(state)...)
+
+	// the server echoes messages in order, so each reply matches the oldest
+	// message still waiting for one
+	var mu sync.Mutex
+	var pending []time.Time
 
 	done := make(chan struct{})
 
@@ -44,7 +98,17 @@ func (o *Options) dial(logger logr.Logger) {
 				logger.Error(err, "read error")
 				return
 			}
-			logger.Info("received message", "message", string(message))
+			o.metrics.websocketMessage("received")
+			values := []interface{}{"message", string(message)}
+			mu.Lock()
+			if len(pending) > 0 {
+				rtt := time.Since(pending[0])
+				pending = pending[1:]
+				o.metrics.websocketRTT(rtt)
+				values = append(values, "roundTrip", rtt.String())
+			}
+			mu.Unlock()
+			logger.Info("received message", values...)
 		}
 	}()
 
@@ -58,11 +122,22 @@ func (o *Options) dial(logger logr.Logger) {
 	defer ticker.Stop()
 
 	writeMessage := func(msg []byte) {
+		// the send time is queued before writing, the echo can arrive before
+		// WriteMessage returns. A failed write never gets an echo, drop it.
+		mu.Lock()
+		pending = append(pending, time.Now())
+		mu.Unlock()
 		err := c.WriteMessage(websocket.TextMessage, msg)
 		if err != nil {
+			mu.Lock()
+			if n := len(pending); n > 0 {
+				pending = pending[:n-1]
+			}
+			mu.Unlock()
 			logger.Error(err, "write error", err)
 			return
 		}
+		o.metrics.websocketMessage("sent")
 	}
 
 	closeConnection := func() {
@@ -83,25 +158,26 @@ func (o *Options) dial(logger logr.Logger) {
 
 	select {
 	case <-done:
-		return
+		return true
 	default:
 		writeMessage(o.dataOrDefault(time.Now()))
 	}
 
 	if o.IntervalSeconds <= 0 {
 		closeConnection()
-		return
+		return true
 	}
 
 	for {
 		select {
 		case <-done:
-			return
+			return true
 		case t := <-ticker.C:
 			writeMessage(o.dataOrDefault(t))
 		case <-interrupt:
 			logger.Info("interrupt")
 			closeConnection()
+			return false
 		}
 	}
 }
@@ -0,0 +1,180 @@
+package prestop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/glogr"
+	"github.com/go-logr/logr"
+
+	"github.com/aka-bo/loqu/pkg/server"
+	"github.com/aka-bo/loqu/pkg/util"
+)
+
+// maxPollErrors is the number of consecutive failed state polls tolerated
+// before the hook gives up
+const maxPollErrors = 3
+
+// Options is used to configure the prestop command
+type Options struct {
+	Host      string
+	AdminPort int
+
+	// TimeoutSeconds bounds the whole drain, MinWaitSeconds keeps the hook
+	// running while load balancers catch up even if nothing is in flight
+	TimeoutSeconds      int
+	MinWaitSeconds      int
+	PollIntervalSeconds float64
+}
+
+type prestop struct {
+	*Options
+	client *http.Client
+	logger logr.Logger
+}
+
+// Run starts a drain on the local server and waits for in-flight requests to
+// reach zero. The process exits non-zero if the drain does not finish.
+func Run(o *Options) {
+	logger := glogr.New().WithName("Prestop")
+	logger.Info("Run called", "options", o)
+
+	p := &prestop{
+		Options: o,
+		client:  &http.Client{Timeout: 2 * time.Second},
+		logger:  logger,
+	}
+	if err := p.run(); err != nil {
+		logger.Error(err, "drain did not finish")
+		os.Exit(1)
+	}
+}
+
+func (p *prestop) run() error {
+	start := time.Now()
+	deadline := start.Add(time.Duration(p.TimeoutSeconds) * time.Second)
+	minWait := start.Add(time.Duration(p.MinWaitSeconds) * time.Second)
+
+	state, err := p.startDrain()
+	if err != nil {
+		return err
+	}
+
+	interval := time.Duration(p.PollIntervalSeconds * float64(time.Second))
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	pollErrors := 0
+	for {
+		p.logger.Info("drain progress", "phase", state.Phase.String(), "inFlight", state.InFlight, "websockets", state.Websockets)
+		if state.InFlight == 0 && !time.Now().Before(minWait) {
+			p.logger.Info("drain finished", "elapsed", time.Since(start).String())
+			return nil
+		}
+		if time.Now().After(deadline) {
+			for path, h := range state.Handlers {
+				if h.InFlight > 0 {
+					p.logger.Info("handler still busy", "path", path, "inFlight", h.InFlight, "websockets", h.Websockets)
+				}
+			}
+			return fmt.Errorf("%d requests still in flight after %ds", state.InFlight, p.TimeoutSeconds)
+		}
+
+		<-ticker.C
+		next, err := p.state()
+		switch {
+		case err == nil:
+			state, pollErrors = next, 0
+		case serverExited(err):
+			// the admin listener is only closed once the server has finished
+			// shutting down
+			p.logger.Info("server closed the admin API, drain finished", "elapsed", time.Since(start).String(), "reason", err.Error())
+			return nil
+		default:
+			pollErrors++
+			if pollErrors >= maxPollErrors {
+				return fmt.Errorf("unable to read the server state: %v", err)
+			}
+			p.logger.Info("unable to read the server state, retrying", "error", err.Error(), "attempt", pollErrors)
+		}
+	}
+}
+
+// startDrain asks the server to drain. A server that is already draining,
+// e.g. because SIGTERM arrived first, is not an error.
+func (p *prestop) startDrain() (*server.AdminState, error) {
+	id := util.NewRequestID()
+	req, err := http.NewRequest(http.MethodPost, p.url(server.AdminPathDrain), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(util.KeyRequestID, id)
+
+	logger := p.logger.WithValues("RequestID", id)
+	logger.Info("requesting drain", "url", req.URL.String())
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to request a drain: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted:
+		logger.Info("drain started")
+	case http.StatusConflict:
+		state, err := p.state()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the server state: %v", err)
+		}
+		if state.Phase < server.PhaseDraining {
+			return nil, fmt.Errorf("server refused to drain while %s", state.Phase)
+		}
+		logger.Info("server is already shutting down", "phase", state.Phase.String())
+		return state, nil
+	default:
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("drain request failed with status %d: %s", resp.StatusCode, body)
+	}
+	return decodeState(resp)
+}
+
+func (p *prestop) state() (*server.AdminState, error) {
+	resp, err := p.client.Get(p.url(server.AdminPathState))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return decodeState(resp)
+}
+
+// serverExited reports whether err means the admin listener is gone
+func serverExited(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func decodeState(resp *http.Response) (*server.AdminState, error) {
+	state := &server.AdminState{}
+	if err := json.NewDecoder(resp.Body).Decode(state); err != nil {
+		return nil, fmt.Errorf("invalid server state: %v", err)
+	}
+	return state, nil
+}
+
+func (p *prestop) url(path string) string {
+	return fmt.Sprintf("http://%s:%d%s", p.Host, p.AdminPort, path)
+}
@@ -0,0 +1,198 @@
+package prestop
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/glogr"
+
+	"github.com/aka-bo/loqu/pkg/server"
+)
+
+func TestMain(m *testing.M) {
+	// glog writes to files in the temp directory unless told otherwise
+	flag.Set("logtostderr", "true")
+	flag.Parse()
+	os.Exit(m.Run())
+}
+
+// poll is the admin API answer to a single state request
+type poll struct {
+	inFlight int64
+	phase    server.Phase
+	status   int
+	hangUp   bool
+}
+
+// fakeAdmin answers drain requests with drainStatus and state requests with
+// polls in order, repeating the last one
+type fakeAdmin struct {
+	drainStatus int
+	drainState  poll
+	polls       []poll
+
+	mu    sync.Mutex
+	count int
+}
+
+func (a *fakeAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == server.AdminPathDrain:
+		w.WriteHeader(a.drainStatus)
+		if a.drainStatus == http.StatusAccepted {
+			writeState(w, a.drainState)
+		}
+	case r.Method == http.MethodGet && r.URL.Path == server.AdminPathState:
+		a.mu.Lock()
+		p := a.polls[len(a.polls)-1]
+		if a.count < len(a.polls) {
+			p = a.polls[a.count]
+		}
+		a.count++
+		a.mu.Unlock()
+
+		switch {
+		case p.hangUp:
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		case p.status != 0:
+			w.WriteHeader(p.status)
+		default:
+			writeState(w, p)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// polled returns the number of state requests received
+func (a *fakeAdmin) polled() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.count
+}
+
+func writeState(w http.ResponseWriter, p poll) {
+	phase := p.phase
+	if phase == server.PhaseStarting {
+		phase = server.PhaseDraining
+	}
+	json.NewEncoder(w).Encode(&server.AdminState{Phase: phase, InFlight: p.inFlight})
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		admin       *fakeAdmin
+		closed      bool
+		minWait     int
+		timeout     int
+		wantErr     string
+		wantAtLeast time.Duration
+		wantPolls   int
+	}{
+		{
+			name:      "in flight reaches zero",
+			admin:     &fakeAdmin{drainStatus: http.StatusAccepted, drainState: poll{inFlight: 2}, polls: []poll{{inFlight: 2}, {inFlight: 1}, {inFlight: 0}}},
+			wantPolls: 3,
+		},
+		{
+			name:  "already draining",
+			admin: &fakeAdmin{drainStatus: http.StatusConflict, polls: []poll{{phase: server.PhaseDraining, inFlight: 0}}},
+		},
+		{
+			name:    "conflict while ready",
+			admin:   &fakeAdmin{drainStatus: http.StatusConflict, polls: []poll{{phase: server.PhaseReady}}},
+			wantErr: "refused to drain while ready",
+		},
+		{
+			name:    "drain request failed",
+			admin:   &fakeAdmin{drainStatus: http.StatusInternalServerError},
+			wantErr: "drain request failed with status 500",
+		},
+		{
+			name:    "admin api not listening",
+			admin:   &fakeAdmin{},
+			closed:  true,
+			wantErr: "unable to request a drain",
+		},
+		{
+			name:  "admin api closed mid poll",
+			admin: &fakeAdmin{drainStatus: http.StatusAccepted, drainState: poll{inFlight: 3}, polls: []poll{{inFlight: 3}, {hangUp: true}}},
+		},
+		{
+			name:  "transient errors retried",
+			admin: &fakeAdmin{drainStatus: http.StatusAccepted, drainState: poll{inFlight: 1}, polls: []poll{{status: 500}, {status: 500}, {inFlight: 0}}},
+		},
+		{
+			name:    "persistent errors",
+			admin:   &fakeAdmin{drainStatus: http.StatusAccepted, drainState: poll{inFlight: 1}, polls: []poll{{status: 500}}},
+			wantErr: "unable to read the server state: unexpected status 500",
+		},
+		{
+			name:        "min wait floor",
+			admin:       &fakeAdmin{drainStatus: http.StatusAccepted, polls: []poll{{inFlight: 0}}},
+			minWait:     1,
+			wantAtLeast: time.Second,
+		},
+		{
+			name:        "timeout",
+			admin:       &fakeAdmin{drainStatus: http.StatusAccepted, drainState: poll{inFlight: 1}, polls: []poll{{inFlight: 1}}},
+			timeout:     1,
+			wantErr:     "1 requests still in flight after 1s",
+			wantAtLeast: time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := httptest.NewServer(tt.admin)
+			defer admin.Close()
+			u, _ := url.Parse(admin.URL)
+			port, _ := strconv.Atoi(u.Port())
+			if tt.closed {
+				admin.Close()
+			}
+
+			timeout := tt.timeout
+			if timeout == 0 {
+				timeout = 10
+			}
+			p := &prestop{
+				Options: &Options{
+					Host:                u.Hostname(),
+					AdminPort:           port,
+					TimeoutSeconds:      timeout,
+					MinWaitSeconds:      tt.minWait,
+					PollIntervalSeconds: 0.01,
+				},
+				client: &http.Client{Timeout: 2 * time.Second},
+				logger: glogr.New().WithName("Prestop"),
+			}
+
+			start := time.Now()
+			err := p.run()
+			elapsed := time.Since(start)
+			switch {
+			case len(tt.wantErr) == 0 && err != nil:
+				t.Fatalf("run() returned an error: %v", err)
+			case len(tt.wantErr) > 0 && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("run() = %v, want an error containing %q", err, tt.wantErr)
+			}
+			if elapsed < tt.wantAtLeast {
+				t.Errorf("run() returned after %s, want at least %s", elapsed, tt.wantAtLeast)
+			}
+			if polled := tt.admin.polled(); polled < tt.wantPolls {
+				t.Errorf("state polled %d times, want at least %d", polled, tt.wantPolls)
+			}
+		})
+	}
+}
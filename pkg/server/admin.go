@@ -0,0 +1,356 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/glogr"
+	"github.com/go-logr/logr"
+
+	"github.com/aka-bo/loqu/pkg/util"
+)
+
+// Admin API paths
+const (
+	AdminPathState       = "/state"
+	AdminPathReady       = "/ready"
+	AdminPathUnready     = "/unready"
+	AdminPathDrain       = "/drain"
+	AdminPathDrainCancel = "/drain/cancel"
+	AdminPathFaults      = "/faults"
+)
+
+// HandlerActivity is the work in progress for a single handler path
+type HandlerActivity struct {
+	InFlight   int64 `json:"inFlight"`
+	Websockets int64 `json:"websockets"`
+}
+
+// AdminState is returned by the admin state endpoint
+type AdminState struct {
+	Hostname      string                     `json:"hostname"`
+	Version       string                     `json:"version,omitempty"`
+	Phase         Phase                      `json:"phase"`
+	Phases        map[string]time.Time       `json:"phases"`
+	MarkedUnready bool                       `json:"markedUnready"`
+	InFlight      int64                      `json:"inFlight"`
+	Websockets    int64                      `json:"websockets"`
+	Handlers      map[string]HandlerActivity `json:"handlers"`
+	Drain         *drainSummary              `json:"drain,omitempty"`
+	Faults        []FaultProfile             `json:"faults"`
+}
+
+// admin serves the runtime control API on its own port. Drain and cancel
+// requests are passed to Run, which owns the shutdown sequence.
+type admin struct {
+	state    *serverState
+	drain    *drainTracker
+	faults   *faultInjector
+	handlers handlerMap
+	logger   logr.Logger
+
+	drainRequests  chan string
+	cancelRequests chan string
+
+	// cancel is guarded by cancelMu, a cancel request is only accepted while
+	// Run is still waiting out the shutdown delay
+	cancelMu sync.Mutex
+	cancel   cancelWindow
+}
+
+// cancelWindow tracks whether a drain can still be cancelled
+type cancelWindow int
+
+const (
+	cancelClosed cancelWindow = iota
+	cancelOpen
+	cancelRequested
+)
+
+// openCancel allows a drain cancel until closeCancel is called
+func (a *admin) openCancel() {
+	a.cancelMu.Lock()
+	defer a.cancelMu.Unlock()
+	a.cancel = cancelOpen
+}
+
+// closeCancel ends the cancel window once the shutdown delay has passed. It
+// returns the request ID of a cancel accepted before then that Run has not
+// received yet.
+func (a *admin) closeCancel() (string, bool) {
+	a.cancelMu.Lock()
+	defer a.cancelMu.Unlock()
+	previous := a.cancel
+	a.cancel = cancelClosed
+	if previous != cancelRequested {
+		return "", false
+	}
+	select {
+	case id := <-a.cancelRequests:
+		return id, true
+	default:
+		return "", false
+	}
+}
+
+// requestCancel passes a cancel request to Run. accepted is false once the
+// shutdown delay has passed, when Run would ignore it, and duplicate is set
+// when an earlier cancel is still pending.
+func (a *admin) requestCancel(id string) (accepted, duplicate bool) {
+	a.cancelMu.Lock()
+	defer a.cancelMu.Unlock()
+	switch a.cancel {
+	case cancelRequested:
+		return true, true
+	case cancelOpen:
+		a.cancelRequests <- id
+		a.cancel = cancelRequested
+		return true, false
+	}
+	return false, false
+}
+
+func newAdmin(state *serverState, drain *drainTracker, faults *faultInjector, handlers handlerMap) *admin {
+	return &admin{
+		state:          state,
+		drain:          drain,
+		faults:         faults,
+		handlers:       handlers,
+		logger:         glogr.New().WithName("Admin"),
+		drainRequests:  make(chan string, 1),
+		cancelRequests: make(chan string, 1),
+	}
+}
+
+// serve starts the admin listener on the given address and port
+func (a *admin) serve(address string, port int) *http.Server {
+	addr := net.JoinHostPort(address, strconv.Itoa(port))
+	s := &http.Server{
+		Addr:    addr,
+		Handler: a.handler(),
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		a.logger.Info("Starting admin server", "addr", addr)
+		if err := s.Serve(l); err != nil && err != http.ErrServerClosed {
+			a.logger.Error(err, "admin server exited with error")
+		}
+	}()
+	return s
+}
+
+// handler routes the admin API paths
+func (a *admin) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(AdminPathState, a.handleState)
+	mux.HandleFunc(AdminPathReady, a.handleReady(false))
+	mux.HandleFunc(AdminPathUnready, a.handleReady(true))
+	mux.HandleFunc(AdminPathDrain, a.handleDrain)
+	mux.HandleFunc(AdminPathDrainCancel, a.handleDrainCancel)
+	mux.HandleFunc(AdminPathFaults, a.handleFaults)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r.WithContext(util.RequestContext(r)))
+	})
+}
+
+// currentState captures the lifecycle, activity and fault settings
+func (a *admin) currentState() *AdminState {
+	s := &AdminState{
+		Hostname:      a.state.hostname,
+		Version:       a.state.version,
+		Phase:         a.state.lifecycle.Phase(),
+		Phases:        a.state.lifecycle.Timestamps(),
+		MarkedUnready: a.state.markedUnready(),
+		Handlers:      map[string]HandlerActivity{},
+		Faults:        a.faults.list(),
+	}
+	for p, h := range a.drain.handlers {
+		activity := HandlerActivity{
+			InFlight:   atomic.LoadInt64(&h.inFlight),
+			Websockets: atomic.LoadInt64(&h.websockets),
+		}
+		s.InFlight += activity.InFlight
+		s.Websockets += activity.Websockets
+		s.Handlers[p] = activity
+	}
+	if a.drain.isSignalled() {
+		summary := a.drain.summary()
+		s.Drain = &summary
+	}
+	sort.Slice(s.Faults, func(i, j int) bool { return s.Faults[i].Path < s.Faults[j].Path })
+	return s
+}
+
+func (a *admin) handleState(w http.ResponseWriter, r *http.Request) {
+	logger := util.WithID("Admin", r).WithValues("path", r.URL.Path)
+	logger.V(2).Info("Handling request")
+
+	if r.Method != http.MethodGet {
+		a.methodNotAllowed(w, logger)
+		return
+	}
+	a.writeState(w, http.StatusOK, logger)
+}
+
+// handleReady sets or clears the unready flag used by /readyz
+func (a *admin) handleReady(unready bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := util.WithID("Admin", r).WithValues("path", r.URL.Path)
+		logger.Info("Handling request")
+
+		if r.Method != http.MethodPost {
+			a.methodNotAllowed(w, logger)
+			return
+		}
+		a.state.setUnready(unready)
+		logger.Info("readiness changed through the admin API", "markedUnready", unready)
+		a.writeState(w, http.StatusOK, logger)
+	}
+}
+
+// handleDrain starts the shutdown sequence as if SIGTERM had been received
+func (a *admin) handleDrain(w http.ResponseWriter, r *http.Request) {
+	logger := util.WithID("Admin", r).WithValues("path", r.URL.Path)
+	logger.Info("Handling request")
+
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, logger)
+		return
+	}
+	if phase := a.state.lifecycle.Phase(); phase != PhaseReady {
+		logger.Info("drain requested but the server is not ready", "phase", phase.String())
+		write(w, http.StatusConflict, errorResponseCode(fmt.Sprintf("server is %s", phase), http.StatusConflict), logger)
+		return
+	}
+
+	select {
+	case a.drainRequests <- util.GetRequestID(r):
+		logger.Info("drain requested")
+	default:
+		logger.Info("drain already requested")
+	}
+	a.writeState(w, http.StatusAccepted, logger)
+}
+
+// handleDrainCancel returns a draining server to service. It is refused once
+// the shutdown delay has passed.
+func (a *admin) handleDrainCancel(w http.ResponseWriter, r *http.Request) {
+	logger := util.WithID("Admin", r).WithValues("path", r.URL.Path)
+	logger.Info("Handling request")
+
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, logger)
+		return
+	}
+	if phase := a.state.lifecycle.Phase(); phase != PhaseDraining {
+		logger.Info("drain cancel requested but the server is not draining", "phase", phase.String())
+		write(w, http.StatusConflict, errorResponseCode(fmt.Sprintf("server is %s", phase), http.StatusConflict), logger)
+		return
+	}
+
+	accepted, duplicate := a.requestCancel(util.GetRequestID(r))
+	switch {
+	case !accepted:
+		logger.Info("drain cancel requested after the shutdown delay")
+		write(w, http.StatusConflict, errorResponseCode("the shutdown delay has passed, the drain can no longer be cancelled", http.StatusConflict), logger)
+		return
+	case duplicate:
+		logger.Info("drain cancel already requested")
+	default:
+		logger.Info("drain cancel requested")
+	}
+	a.writeState(w, http.StatusAccepted, logger)
+}
+
+// handleFaults lists the active fault profiles, or replaces them on PUT and
+// clears them on DELETE
+func (a *admin) handleFaults(w http.ResponseWriter, r *http.Request) {
+	logger := util.WithID("Admin", r).WithValues("path", r.URL.Path)
+	logger.Info("Handling request")
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		profiles, err := decodeFaultProfiles(r)
+		if err != nil {
+			write(w, http.StatusBadRequest, errorResponseCode(fmt.Sprintf("invalid fault profiles: %v", err), http.StatusBadRequest), logger)
+			return
+		}
+		for i := range profiles {
+			if err := profiles[i].Validate(); err != nil {
+				write(w, http.StatusBadRequest, errorResponseCode(err.Error(), http.StatusBadRequest), logger)
+				return
+			}
+			if _, ok := a.handlers[profiles[i].Path]; !ok {
+				logger.Info("fault profile does not match a handler path and will be ignored", "profile", profiles[i].Path)
+			}
+		}
+		a.faults.set(profiles)
+		logger.Info("fault profiles replaced through the admin API", "profiles", profiles)
+	case http.MethodDelete:
+		a.faults.set(nil)
+		logger.Info("fault profiles cleared through the admin API")
+	default:
+		a.methodNotAllowed(w, logger)
+		return
+	}
+
+	b, err := marshal(a.currentState().Faults, true)
+	if err != nil {
+		write(w, http.StatusInternalServerError, errorResponse("Unable to marshal json response"), logger)
+		return
+	}
+	write(w, http.StatusOK, b, logger)
+}
+
+// decodeFaultProfiles reads a JSON array of profiles, or one --fault style
+// spec per line for any other content type
+func decodeFaultProfiles(r *http.Request) ([]FaultProfile, error) {
+	var profiles []FaultProfile
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		err := json.NewDecoder(r.Body).Decode(&profiles)
+		return profiles, err
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		p, err := ParseFaultProfile(line)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, scanner.Err()
+}
+
+func (a *admin) writeState(w http.ResponseWriter, status int, logger logr.Logger) {
+	b, err := marshal(a.currentState(), true)
+	if err != nil {
+		write(w, http.StatusInternalServerError, errorResponse("Unable to marshal json response"), logger)
+		return
+	}
+	write(w, status, b, logger)
+}
+
+func (a *admin) methodNotAllowed(w http.ResponseWriter, logger logr.Logger) {
+	write(w, http.StatusMethodNotAllowed, errorResponseCode("method not allowed", http.StatusMethodNotAllowed), logger)
+}
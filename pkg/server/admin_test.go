@@ -0,0 +1,232 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAdmin(phases ...Phase) *admin {
+	state := &serverState{hostname: "test", lifecycle: NewLifecycle()}
+	for _, p := range phases {
+		state.lifecycle.Transition(p)
+	}
+	return newAdmin(state, newDrainTracker(), newFaultInjector(nil), handlerMap{"/": nil, "/echo": nil})
+}
+
+func adminDo(t *testing.T, a *admin, method, path, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if len(contentType) > 0 {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	a.handler().ServeHTTP(w, r)
+	return w
+}
+
+func TestAdminMethods(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{method: http.MethodGet, path: AdminPathState, code: http.StatusOK},
+		{method: http.MethodPost, path: AdminPathState, code: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: AdminPathReady, code: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: AdminPathUnready, code: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: AdminPathDrain, code: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, path: AdminPathDrainCancel, code: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: AdminPathFaults, code: http.StatusOK},
+		{method: http.MethodPost, path: AdminPathFaults, code: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, path: AdminPathFaults, code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			if w := adminDo(t, newTestAdmin(PhaseReady), tt.method, tt.path, "", ""); w.Code != tt.code {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+		})
+	}
+}
+
+func TestAdminReadiness(t *testing.T) {
+	a := newTestAdmin(PhaseReady)
+	for _, step := range []struct {
+		path    string
+		unready bool
+	}{
+		{path: AdminPathUnready, unready: true},
+		{path: AdminPathUnready, unready: true},
+		{path: AdminPathReady, unready: false},
+	} {
+		w := adminDo(t, a, http.MethodPost, step.path, "", "")
+		var state AdminState
+		if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil {
+			t.Fatalf("POST %s: %v", step.path, err)
+		}
+		if w.Code != http.StatusOK || state.MarkedUnready != step.unready || a.state.markedUnready() != step.unready {
+			t.Errorf("POST %s = %d, markedUnready %v, want 200 and %v", step.path, w.Code, state.MarkedUnready, step.unready)
+		}
+	}
+}
+
+func TestAdminDrain(t *testing.T) {
+	tests := []struct {
+		name   string
+		phases []Phase
+		code   int
+	}{
+		{name: "starting", code: http.StatusConflict},
+		{name: "ready", phases: []Phase{PhaseReady}, code: http.StatusAccepted},
+		{name: "draining", phases: []Phase{PhaseReady, PhaseDraining}, code: http.StatusConflict},
+		{name: "terminating", phases: []Phase{PhaseReady, PhaseDraining, PhaseTerminating}, code: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAdmin(tt.phases...)
+			w := adminDo(t, a, http.MethodPost, AdminPathDrain, "", "")
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			requested := len(a.drainRequests) == 1
+			if requested != (tt.code == http.StatusAccepted) {
+				t.Errorf("drain passed to Run = %v after a %d", requested, w.Code)
+			}
+		})
+	}
+
+	t.Run("repeated", func(t *testing.T) {
+		a := newTestAdmin(PhaseReady)
+		for i := 0; i < 2; i++ {
+			if w := adminDo(t, a, http.MethodPost, AdminPathDrain, "", ""); w.Code != http.StatusAccepted {
+				t.Fatalf("request %d: status = %d, want %d", i, w.Code, http.StatusAccepted)
+			}
+		}
+		if len(a.drainRequests) != 1 {
+			t.Errorf("%d drain requests queued, want 1", len(a.drainRequests))
+		}
+	})
+}
+
+func TestAdminDrainCancel(t *testing.T) {
+	cancel := func(a *admin) int {
+		return adminDo(t, a, http.MethodPost, AdminPathDrainCancel, "", "").Code
+	}
+
+	t.Run("not draining", func(t *testing.T) {
+		a := newTestAdmin(PhaseReady)
+		a.openCancel()
+		if code := cancel(a); code != http.StatusConflict {
+			t.Errorf("status = %d, want %d", code, http.StatusConflict)
+		}
+	})
+
+	t.Run("within the delay", func(t *testing.T) {
+		a := newTestAdmin(PhaseReady)
+		a.openCancel()
+		a.state.lifecycle.Transition(PhaseDraining)
+		for i := 0; i < 2; i++ {
+			if code := cancel(a); code != http.StatusAccepted {
+				t.Fatalf("request %d: status = %d, want %d", i, code, http.StatusAccepted)
+			}
+		}
+		select {
+		case <-a.cancelRequests:
+		case <-time.After(time.Second):
+			t.Fatal("the cancel was not passed to Run")
+		}
+		if len(a.cancelRequests) != 0 {
+			t.Errorf("a duplicate cancel was queued")
+		}
+	})
+
+	t.Run("after the delay", func(t *testing.T) {
+		a := newTestAdmin(PhaseReady)
+		a.openCancel()
+		a.state.lifecycle.Transition(PhaseDraining)
+		if _, ok := a.closeCancel(); ok {
+			t.Fatal("closeCancel() reported a cancel that was never requested")
+		}
+		if code := cancel(a); code != http.StatusConflict {
+			t.Errorf("status = %d, want %d", code, http.StatusConflict)
+		}
+		if len(a.cancelRequests) != 0 {
+			t.Errorf("a cancel that will be ignored was queued")
+		}
+	})
+
+	t.Run("accepted as the delay ends", func(t *testing.T) {
+		a := newTestAdmin(PhaseReady)
+		a.openCancel()
+		a.state.lifecycle.Transition(PhaseDraining)
+		if code := cancel(a); code != http.StatusAccepted {
+			t.Fatalf("status = %d, want %d", code, http.StatusAccepted)
+		}
+		if _, ok := a.closeCancel(); !ok {
+			t.Error("closeCancel() dropped an accepted cancel")
+		}
+	})
+}
+
+func TestAdminFaults(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		code        int
+		paths       []string
+	}{
+		{
+			name: "json", contentType: "application/json",
+			body: `[{"path":"/","errorRate":0.1},{"path":"/echo","hangRate":0.5,"hangDuration":"30s"}]`,
+			code: http.StatusOK, paths: []string{"/", "/echo"},
+		},
+		{
+			name: "json with charset", contentType: "application/json; charset=utf-8",
+			body: `[{"path":"/","latency":"normal","latencyMean":"100ms"}]`,
+			code: http.StatusOK, paths: []string{"/"},
+		},
+		{name: "json rate out of range", contentType: "application/json", body: `[{"path":"/","errorRate":2}]`, code: http.StatusBadRequest},
+		{name: "json missing path", contentType: "application/json", body: `[{"errorRate":0.1}]`, code: http.StatusBadRequest},
+		{name: "json nanoseconds", contentType: "application/json", body: `[{"path":"/","hangRate":1,"hangDuration":30000000000}]`, code: http.StatusBadRequest},
+		{name: "json malformed", contentType: "application/json", body: `[{"path":`, code: http.StatusBadRequest},
+		{
+			name: "lines", contentType: "text/plain",
+			body: "path=/,error-rate=0.05\n\n  path=/echo,hang-rate=0.1,hang=1s  \n",
+			code: http.StatusOK, paths: []string{"/", "/echo"},
+		},
+		{name: "lines without content type", body: "path=/,error-rate=0.5", code: http.StatusOK, paths: []string{"/"}},
+		{name: "lines invalid", contentType: "text/plain", body: "path=/,error-rate=NaN", code: http.StatusBadRequest},
+		{name: "lines unknown setting", contentType: "text/plain", body: "path=/\npath=/echo,color=red", code: http.StatusBadRequest},
+		{name: "empty", contentType: "text/plain", code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAdmin(PhaseReady)
+			a.faults.set([]FaultProfile{{Path: "/previous"}})
+
+			w := adminDo(t, a, http.MethodPut, AdminPathFaults, tt.contentType, tt.body)
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+
+			var paths []string
+			for _, p := range a.faults.list() {
+				paths = append(paths, p.Path)
+			}
+			want := tt.paths
+			if tt.code != http.StatusOK {
+				want = []string{"/previous"}
+			}
+			sort.Strings(paths)
+			if strings.Join(paths, ",") != strings.Join(want, ",") {
+				t.Errorf("active faults = %v, want %v", paths, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request parameters that shape the response of the Default handler. Each
+// can be given as a query parameter or as a request header, the query
+// parameter wins when both are present.
+const (
+	paramStatus = "status"
+	paramDelay  = "delay"
+	paramSize   = "size"
+	paramHeader = "header"
+
+	behaviorHeaderPrefix = "X-Loqu-"
+
+	maxResponseSize = 1 << 30
+)
+
+// reservedHeaders cannot be set with the header parameter. They are set by
+// the handler or by net/http to frame the response, and a different value
+// would truncate or corrupt it.
+var reservedHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Keep-Alive":        true,
+	"Proxy-Connection":  true,
+	"Te":                true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// behavior describes how a response should deviate from the default echo
+type behavior struct {
+	status  int
+	delay   time.Duration
+	size    int64
+	headers http.Header
+}
+
+func (b *behavior) values() []interface{} {
+	return []interface{}{"status", b.status, "delay", b.delay.String(), "size", b.size, "headers", b.headers}
+}
+
+func (b *behavior) isDefault() bool {
+	return b.status == http.StatusOK && b.delay == 0 && b.size < 0 && len(b.headers) == 0
+}
+
+func behaviorParams(r *http.Request, name string) []string {
+	if v, ok := r.URL.Query()[name]; ok {
+		return v
+	}
+	return r.Header.Values(behaviorHeaderPrefix + name)
+}
+
+func behaviorParam(r *http.Request, name string) string {
+	v := behaviorParams(r, name)
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+// parseBehavior reads the status, delay, size and header parameters from the request
+func parseBehavior(r *http.Request) (*behavior, error) {
+	b := &behavior{
+		status:  http.StatusOK,
+		size:    -1,
+		headers: http.Header{},
+	}
+
+	if v := behaviorParam(r, paramStatus); len(v) > 0 {
+		status, err := strconv.Atoi(v)
+		if err != nil || status < 200 || status > 599 {
+			return nil, fmt.Errorf("invalid status %q, expected a number between 200 and 599", v)
+		}
+		b.status = status
+	}
+
+	if v := behaviorParam(r, paramDelay); len(v) > 0 {
+		delay, err := time.ParseDuration(v)
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf("invalid delay %q, expected a duration such as 250ms or 2s", v)
+		}
+		b.delay = delay
+	}
+
+	if v := behaviorParam(r, paramSize); len(v) > 0 {
+		size, err := ParseSize(v)
+		if err != nil {
+			return nil, err
+		}
+		if size > maxResponseSize {
+			return nil, fmt.Errorf("invalid size %q, the maximum is 1GiB", v)
+		}
+		b.size = size
+	}
+
+	for _, v := range behaviorParams(r, paramHeader) {
+		parts := strings.SplitN(v, ":", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+			return nil, fmt.Errorf("invalid header %q, expected Name:value", v)
+		}
+		name := http.CanonicalHeaderKey(strings.TrimSpace(parts[0]))
+		if reservedHeaders[name] {
+			return nil, fmt.Errorf("invalid header %q, %s is set by the server", v, name)
+		}
+		b.headers.Add(name, strings.TrimSpace(parts[1]))
+	}
+
+	return b, nil
+}
+
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"B", 1},
+}
+
+// ParseSize parses a byte count such as 512, 10KiB, 1MiB or 2MB
+func ParseSize(v string) (int64, error) {
+	s := strings.TrimSpace(v)
+	multiplier := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(strings.ToUpper(s), strings.ToUpper(u.suffix)) {
+			s = strings.TrimSpace(s[:len(s)-len(u.suffix)])
+			multiplier = u.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	// ParseFloat accepts Inf and NaN, and larger values do not fit an int64
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) || n*float64(multiplier) >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q, expected a byte count such as 512, 10KiB or 1MiB", v)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// fillerReader produces an endless stream of printable filler bytes
+type fillerReader struct {
+	offset int
+}
+
+const filler = "loqu-has-a-lot-to-say\n"
+
+func (f *fillerReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = filler[f.offset]
+		f.offset = (f.offset + 1) % len(filler)
+	}
+	return len(p), nil
+}
+
+// writeSized writes exactly size bytes of filler data
+func writeSized(w http.ResponseWriter, status int, size int64) (int64, error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(status)
+	return io.CopyN(w, &fillerReader{}, size)
+}
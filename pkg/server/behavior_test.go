@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "512", want: 512},
+		{in: "512B", want: 512},
+		{in: "10KiB", want: 10 << 10},
+		{in: "10kib", want: 10 << 10},
+		{in: "1.5MiB", want: 3 << 19},
+		{in: "2MB", want: 2000000},
+		{in: "1G", want: 1 << 30},
+		{in: " 4 KiB ", want: 4 << 10},
+		{in: "", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "NaN", wantErr: true},
+		{in: "Inf", wantErr: true},
+		{in: "+Inf", wantErr: true},
+		{in: "-InfKiB", wantErr: true},
+		{in: "1e30", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseSize(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseSize(%q) = %d, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSize(%q) returned an error: %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBehaviorHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   []string
+		header  []string
+		want    http.Header
+		wantErr string
+	}{
+		{name: "none", want: http.Header{}},
+		{name: "query", query: []string{"Cache-Control: no-store", "x-custom:a"},
+			want: http.Header{"Cache-Control": {"no-store"}, "X-Custom": {"a"}}},
+		{name: "repeated", query: []string{"X-Custom:a", "x-custom:b"}, want: http.Header{"X-Custom": {"a", "b"}}},
+		{name: "request header", header: []string{"Retry-After: 5"}, want: http.Header{"Retry-After": {"5"}}},
+		{name: "value with colons", query: []string{"Location:http://example.com:8080/"}, want: http.Header{"Location": {"http://example.com:8080/"}}},
+		{name: "missing value", query: []string{"X-Custom"}, wantErr: "expected Name:value"},
+		{name: "missing name", query: []string{" :a"}, wantErr: "expected Name:value"},
+		{name: "content length", query: []string{"Content-Length:5"}, wantErr: "Content-Length is set by the server"},
+		{name: "content type", query: []string{"content-type:text/html"}, wantErr: "Content-Type is set by the server"},
+		{name: "transfer encoding", header: []string{"Transfer-Encoding: chunked"}, wantErr: "Transfer-Encoding is set by the server"},
+		{name: "content encoding", query: []string{"Content-Encoding:gzip"}, wantErr: "Content-Encoding is set by the server"},
+		{name: "connection", query: []string{"X-Custom:a", "Connection:close"}, wantErr: "Connection is set by the server"},
+		{name: "te", query: []string{"TE:trailers"}, wantErr: "Te is set by the server"},
+		{name: "upgrade", query: []string{"Upgrade:websocket"}, wantErr: "Upgrade is set by the server"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/?"+url.Values{paramHeader: tt.query}.Encode(), nil)
+			for _, h := range tt.header {
+				r.Header.Add(behaviorHeaderPrefix+paramHeader, h)
+			}
+
+			b, err := parseBehavior(r)
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseBehavior() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBehavior() returned an error: %v", err)
+			}
+			if !reflect.DeepEqual(b.headers, tt.want) {
+				t.Errorf("headers = %v, want %v", b.headers, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/aka-bo/loqu/pkg/util"
+)
+
+// Request parameters of the Chunked handler. Like the Default handler
+// parameters they can be given as query parameters or X-Loqu- headers.
+const (
+	paramChunks     = "chunks"
+	paramChunkSize  = "chunk-size"
+	paramInterval   = "interval"
+	paramStallAfter = "stall-after"
+	paramStall      = "stall"
+	paramAbortAfter = "abort-after"
+
+	defaultChunks   = 10
+	defaultInterval = time.Second
+	maxChunks       = 100000
+	maxChunkSize    = 1 << 20
+)
+
+// streaming describes how the Chunked handler writes its body. stallAfter and
+// abortAfter are chunk counts, -1 disables them.
+type streaming struct {
+	chunks     int
+	chunkSize  int64
+	interval   time.Duration
+	stallAfter int
+	stall      time.Duration
+	abortAfter int
+}
+
+func (s *streaming) values() []interface{} {
+	return []interface{}{"chunks", s.chunks, "chunkSize", s.chunkSize, "interval", s.interval.String(),
+		"stallAfter", s.stallAfter, "stall", s.stall.String(), "abortAfter", s.abortAfter}
+}
+
+func intParam(r *http.Request, name string, def, min, max int) (int, error) {
+	v := behaviorParam(r, name)
+	if len(v) == 0 {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("invalid %s %q, expected a number between %d and %d", name, v, min, max)
+	}
+	return n, nil
+}
+
+func durationParam(r *http.Request, name string, def time.Duration) (time.Duration, error) {
+	v := behaviorParam(r, name)
+	if len(v) == 0 {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a duration such as 250ms or 2s", name, v)
+	}
+	return d, nil
+}
+
+// parseStreaming reads the chunked streaming parameters from the request
+func parseStreaming(r *http.Request) (*streaming, error) {
+	s := &streaming{}
+	var err error
+
+	if s.chunks, err = intParam(r, paramChunks, defaultChunks, 1, maxChunks); err != nil {
+		return nil, err
+	}
+	if v := behaviorParam(r, paramChunkSize); len(v) > 0 {
+		if s.chunkSize, err = ParseSize(v); err != nil {
+			return nil, err
+		}
+		if s.chunkSize > maxChunkSize {
+			return nil, fmt.Errorf("invalid %s %q, the maximum is 1MiB", paramChunkSize, v)
+		}
+	}
+	if s.interval, err = durationParam(r, paramInterval, defaultInterval); err != nil {
+		return nil, err
+	}
+	if s.stallAfter, err = intParam(r, paramStallAfter, -1, 0, s.chunks-1); err != nil {
+		return nil, err
+	}
+	if s.stall, err = durationParam(r, paramStall, 0); err != nil {
+		return nil, err
+	}
+	if s.abortAfter, err = intParam(r, paramAbortAfter, -1, 0, s.chunks-1); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Chunked writes its response body in chunks, flushing each one and waiting
+// between them. The body can also stall part way through, or be aborted by
+// closing the connection, to see how proxies handle half-sent responses.
+type Chunked struct {
+	state *serverState
+}
+
+// Handle the request. The chunks, chunk-size, interval, stall-after, stall and
+// abort-after request parameters control the body.
+func (c *Chunked) Handle(w http.ResponseWriter, r *http.Request) {
+	logger := util.WithID("Handle", r).WithValues("path", r.URL.Path)
+	logger.Info("Handling request")
+
+	s, err := parseStreaming(r)
+	if err != nil {
+		logger.Error(err, "Invalid streaming behavior requested")
+		write(w, http.StatusBadRequest, errorResponseCode(err.Error(), http.StatusBadRequest), logger)
+		return
+	}
+	logger.Info("Streaming response", s.values()...)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		write(w, http.StatusInternalServerError, errorResponse("streaming is not supported"), logger)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	shutdownLogged := false
+	for i := 0; i < s.chunks; i++ {
+		if i == s.abortAfter {
+			c.abort(w, r, i, logger)
+			return
+		}
+		if i == s.stallAfter {
+			logger.Info("Stalling response", "sent", i, "stall", s.stall.String())
+			if !c.stall(r, s.stall) {
+				logger.Info("Request cancelled while stalled", "sent", i)
+				return
+			}
+			logger.Info("Resuming response", "sent", i)
+		}
+		if i > 0 && !sleep(r, s.interval, logger) {
+			logger.Info("Request cancelled mid-body", "sent", i)
+			return
+		}
+		if c.state.stopping() && !shutdownLogged {
+			logger.Info("Shutdown signal received. streaming will continue normally.", "sent", i)
+			shutdownLogged = true
+		}
+
+		if err := c.writeChunk(w, r, i, s); err != nil {
+			logger.Error(err, "error writing data to the response writer", "sent", i)
+			return
+		}
+		flusher.Flush()
+		if logger.V(3).Enabled() {
+			logger.Info("Chunk sent", "chunk", i+1, "chunks", s.chunks)
+		}
+	}
+	logger.Info("Response complete", "sent", s.chunks)
+}
+
+func (c *Chunked) writeChunk(w http.ResponseWriter, r *http.Request, i int, s *streaming) error {
+	line := fmt.Sprintf("chunk %d/%d %s %s %s\n", i+1, s.chunks, c.state.hostname, util.GetRequestID(r), time.Now().Format(time.RFC3339Nano))
+	if _, err := io.WriteString(w, line); err != nil {
+		return err
+	}
+	// pad with filler, keeping one chunk per line
+	if pad := s.chunkSize - int64(len(line)); pad > 1 {
+		if _, err := io.CopyN(w, &fillerReader{}, pad-1); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	}
+	return nil
+}
+
+// stall waits for d, or until the request is cancelled when d is 0
+func (c *Chunked) stall(r *http.Request, d time.Duration) bool {
+	if d == 0 {
+		<-r.Context().Done()
+		return false
+	}
+	select {
+	case <-time.After(d):
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// abort closes the connection without finishing the body. HTTP/2 streams
+// cannot be hijacked, they are reset instead.
+func (c *Chunked) abort(w http.ResponseWriter, r *http.Request, sent int, logger logr.Logger) {
+	if hj, ok := w.(http.Hijacker); ok {
+		conn, _, err := hj.Hijack()
+		if err == nil {
+			logger.Info("Aborting response by closing the connection", "sent", sent, "protocol", r.Proto)
+			conn.Close()
+			return
+		}
+		if err != http.ErrNotSupported {
+			logger.Error(err, "unable to hijack connection, resetting the stream instead", "sent", sent)
+		}
+	}
+
+	logger.Info("Aborting response by resetting the stream", "sent", sent, "protocol", r.Proto)
+	panic(http.ErrAbortHandler)
+}
+
+// Start the Chunked handler
+func (c *Chunked) Start() {
+	// no-op
+}
+
+// Stop signals that the shutdown process has begun
+func (c *Chunked) Stop() {
+	// no-op, open streams keep going so shutdown behavior can be observed
+}
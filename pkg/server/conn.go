@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/glogr"
+	"github.com/go-logr/logr"
+	"golang.org/x/net/http2"
+
+	"github.com/aka-bo/loqu/pkg/util"
+)
+
+type connectionInfo struct {
+	ID      string `json:"id"`
+	Request int64  `json:"request"`
+}
+
+// conn holds the lifecycle details of a single client connection
+type conn struct {
+	id       string
+	accepted time.Time
+	requests int64
+	state    http.ConnState
+	logger   logr.Logger
+	netConn  net.Conn
+
+	// http2 is set once the connection switched to HTTP/2, streams counts
+	// the requests in flight on it
+	http2   int32
+	streams int64
+}
+
+func (c *conn) markHTTP2() {
+	if atomic.CompareAndSwapInt32(&c.http2, 0, 1) {
+		c.logger.Info("connection switched to HTTP/2")
+	}
+}
+
+func (c *conn) isHTTP2() bool {
+	return atomic.LoadInt32(&c.http2) == 1
+}
+
+type connContextKey struct{}
+type connRequestContextKey struct{}
+
+// connTracker assigns an ID to every connection accepted by the http.Server and
+// logs each state transition
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[net.Conn]*conn
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: map[net.Conn]*conn{}}
+}
+
+// connContext is used as http.Server.ConnContext, it runs before the first state transition
+func (t *connTracker) connContext(ctx context.Context, c net.Conn) context.Context {
+	id := util.NewRequestID()
+	info := &conn{
+		id:       id,
+		accepted: time.Now(),
+		logger:   glogr.New().WithName("Connection").WithValues("ConnectionID", id, "client", c.RemoteAddr().String()),
+		netConn:  c,
+	}
+
+	t.mu.Lock()
+	t.conns[c] = info
+	t.mu.Unlock()
+
+	return context.WithValue(ctx, connContextKey{}, info)
+}
+
+// connState is used as http.Server.ConnState
+func (t *connTracker) connState(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	info, ok := t.conns[c]
+	if ok {
+		info.state = state
+		// h2c connections are hijacked by the http2 server, they are kept
+		// until h2cHandler sees them finish so they still receive GOAWAY
+		if state == http.StateClosed || (state == http.StateHijacked && !info.isHTTP2()) {
+			delete(t.conns, c)
+		}
+	}
+	t.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	values := []interface{}{"state", state.String(), "requests", atomic.LoadInt64(&info.requests)}
+	switch state {
+	case http.StateNew:
+		info.logger.Info("connection accepted", "local", c.LocalAddr().String())
+	case http.StateClosed, http.StateHijacked:
+		info.logger.Info("connection state changed", append(values, "age", time.Since(info.accepted).String())...)
+	default:
+		info.logger.Info("connection state changed", values...)
+	}
+}
+
+// logOpen logs every connection the tracker still considers open
+func (t *connTracker) logOpen(msg string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, info := range t.conns {
+		info.logger.Info(msg, "state", info.state.String(), "requests", atomic.LoadInt64(&info.requests), "age", time.Since(info.accepted).String())
+	}
+	return len(t.conns)
+}
+
+// trackTLSNextProto wraps the "h2" handler installed by http2.ConfigureServer
+// to mark TLS connections as HTTP/2 as soon as ALPN selects it
+func (t *connTracker) trackTLSNextProto(server *http.Server) {
+	serve, ok := server.TLSNextProto[http2.NextProtoTLS]
+	if !ok {
+		return
+	}
+	server.TLSNextProto[http2.NextProtoTLS] = func(s *http.Server, c *tls.Conn, h http.Handler) {
+		t.mu.Lock()
+		info, ok := t.conns[c]
+		t.mu.Unlock()
+		if ok {
+			info.markHTTP2()
+		}
+		serve(s, c, h)
+	}
+}
+
+// h2cHandler marks connections that switch to HTTP/2 through the wrapped h2c
+// handler, which serves them until they are closed
+func (t *connTracker) h2cHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, ok := r.Context().Value(connContextKey{}).(*conn)
+		if !ok || !isH2C(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		info.markHTTP2()
+		defer func() {
+			t.mu.Lock()
+			delete(t.conns, info.netConn)
+			t.mu.Unlock()
+			info.logger.Info("HTTP/2 connection closed", "requests", atomic.LoadInt64(&info.requests), "age", time.Since(info.accepted).String())
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// isH2C reports whether the request starts HTTP/2 over cleartext, either with
+// the prior knowledge preface or an upgrade
+func isH2C(r *http.Request) bool {
+	if r.Method == "PRI" && r.URL.Path == "*" && r.ProtoMajor == 2 {
+		return true
+	}
+	return len(r.Header.Get("HTTP2-Settings")) > 0 && strings.Contains(strings.ToLower(r.Header.Get("Upgrade")), "h2c")
+}
+
+// logGoAway logs one event for every open HTTP/2 connection. It is registered
+// with RegisterOnShutdown next to the http2 hook that sends the GOAWAY frames.
+func (t *connTracker) logGoAway() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, info := range t.conns {
+		if !info.isHTTP2() {
+			continue
+		}
+		// the logger already carries the client address
+		info.logger.Info("GOAWAY sent", "inFlightStreams", atomic.LoadInt64(&info.streams),
+			"requests", atomic.LoadInt64(&info.requests), "age", time.Since(info.accepted).String())
+	}
+}
+
+// trackStream counts an HTTP/2 request as an in-flight stream on its
+// connection, the returned function ends it
+func trackStream(r *http.Request) func() {
+	info, ok := r.Context().Value(connContextKey{}).(*conn)
+	if !ok || r.ProtoMajor != 2 {
+		return func() {}
+	}
+	info.markHTTP2()
+	atomic.AddInt64(&info.streams, 1)
+	return func() {
+		atomic.AddInt64(&info.streams, -1)
+	}
+}
+
+// connRequestContext counts the request against its connection and records
+// the connection ID and request number in the returned context
+func connRequestContext(r *http.Request) context.Context {
+	info, ok := r.Context().Value(connContextKey{}).(*conn)
+	if !ok {
+		return r.Context()
+	}
+	n := atomic.AddInt64(&info.requests, 1)
+	info.logger.V(1).Info("request received", "RequestID", util.GetRequestID(r), "request", n, "proto", r.Proto)
+	return context.WithValue(r.Context(), connRequestContextKey{}, connectionInfo{ID: info.id, Request: n})
+}
+
+func connectionFromRequest(r *http.Request) *connectionInfo {
+	info, ok := r.Context().Value(connRequestContextKey{}).(connectionInfo)
+	if !ok {
+		return nil
+	}
+	return &info
+}
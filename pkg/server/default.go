@@ -2,35 +2,73 @@ package server
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/aka-bo/loqu/pkg/util"
 )
 
 //Default is the default request handler
 type Default struct {
-	serverInfo serverInfo
+	state *serverState
 }
 
-//Handle the request and write a response
+//Handle the request and write a response. The status, delay, size and header
+//request parameters can be used to shape the response.
 func (d *Default) Handle(w http.ResponseWriter, r *http.Request) {
 	logger := util.WithID("Handle", r).WithValues("path", r.URL.Path)
 	logger.Info("Handling request")
 
-	if d.serverInfo.Stopping {
+	if d.state.stopping() {
 		logger.Info("Shutdown signal received. processing will continue normally.")
 	}
 
-	values := buildResponse(&d.serverInfo, r)
-	b, err := marshal(values, true)
+	b, err := parseBehavior(r)
+	if err != nil {
+		logger.Error(err, "Invalid response behavior requested")
+		write(w, http.StatusBadRequest, errorResponseCode(err.Error(), http.StatusBadRequest), logger)
+		return
+	}
+	if !b.isDefault() {
+		logger.Info("Applying requested response behavior", b.values()...)
+	}
+
+	values := buildResponse(d.state, r)
+
+	if b.delay > 0 {
+		select {
+		case <-time.After(b.delay):
+		case <-r.Context().Done():
+			logger.Info("Request cancelled during delay", "delay", b.delay.String())
+			return
+		}
+	}
+
+	for k, v := range b.headers {
+		w.Header()[k] = append(w.Header()[k], v...)
+	}
+
+	if b.size >= 0 {
+		if logger.V(4).Enabled() {
+			b2, _ := marshal(values, false)
+			logger.Info("Writing sized response", "size", b.size, "request", string(b2))
+		}
+		if _, err := writeSized(w, b.status, b.size); err != nil {
+			logger.Error(err, "error writing data to the response writer")
+		}
+		return
+	}
+
+	body, err := marshal(values, true)
 	if err != nil {
 		logger.Error(err, "Unable to marshal response", "values", values)
 		write(w, http.StatusInternalServerError, errorResponse("unable to marshal response"), logger)
+		return
 	}
 	if logger.V(4).Enabled() {
 		b2, _ := marshal(values, false)
 		logger.Info("Writing response", "body", string(b2))
 	}
-	write(w, http.StatusOK, b, logger)
+	write(w, b.status, body, logger)
 }
 
 //Start the HealthCheck
@@ -40,5 +78,5 @@ func (d *Default) Start() {
 
 //Stop signals that the shutdown process has begun
 func (d *Default) Stop() {
-	d.serverInfo.Stopping = true
+	// no-op, the shutdown state is read from the shared lifecycle
 }
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// handlerStats counts the work in progress for a single handler path
+type handlerStats struct {
+	path       string
+	probe      bool
+	inFlight   int64
+	websockets int64
+}
+
+// trackedRequest is added to the request context by drainTracker.wrap
+type trackedRequest struct {
+	stats     *handlerStats
+	websocket bool
+}
+
+type trackedRequestContextKey struct{}
+
+// drainTracker counts in-flight requests and open websockets per handler and
+// tallies how they finished once the shutdown signal has been received
+type drainTracker struct {
+	handlers map[string]*handlerStats
+
+	signalled int32
+	forced    int32
+
+	servedAfterSignal        int64
+	cutOff                   int64
+	websocketsClosedCleanly  int64
+	websocketsClosedForcibly int64
+}
+
+// drainSummary is printed as JSON when the server exits. Probe requests are
+// not counted.
+type drainSummary struct {
+	RequestsServedAfterSignal int64            `json:"requestsServedAfterSignal"`
+	RequestsCutOff            int64            `json:"requestsCutOff"`
+	WebsocketsClosedCleanly   int64            `json:"websocketsClosedCleanly"`
+	WebsocketsClosedForcibly  int64            `json:"websocketsClosedForcibly"`
+	InFlightByHandler         map[string]int64 `json:"inFlightByHandler,omitempty"`
+}
+
+func newDrainTracker() *drainTracker {
+	return &drainTracker{handlers: map[string]*handlerStats{}}
+}
+
+// signal marks the start of the shutdown process
+func (t *drainTracker) signal() {
+	atomic.StoreInt32(&t.signalled, 1)
+}
+
+// resume marks the end of a cancelled drain and resets the drain counters
+func (t *drainTracker) resume() {
+	atomic.StoreInt32(&t.signalled, 0)
+	atomic.StoreInt64(&t.servedAfterSignal, 0)
+	atomic.StoreInt64(&t.cutOff, 0)
+	atomic.StoreInt64(&t.websocketsClosedCleanly, 0)
+	atomic.StoreInt64(&t.websocketsClosedForcibly, 0)
+}
+
+func (t *drainTracker) isSignalled() bool {
+	return atomic.LoadInt32(&t.signalled) == 1
+}
+
+// force marks that remaining connections are about to be closed forcibly
+func (t *drainTracker) force() {
+	atomic.StoreInt32(&t.forced, 1)
+}
+
+func (t *drainTracker) isForced() bool {
+	return atomic.LoadInt32(&t.forced) == 1
+}
+
+// wrap counts requests for path while h is running. It must be called before the server starts.
+func (t *drainTracker) wrap(path string, h http.HandlerFunc) http.HandlerFunc {
+	stats := &handlerStats{path: path, probe: isProbePath(path)}
+	t.handlers[path] = stats
+	return func(w http.ResponseWriter, r *http.Request) {
+		tracked := &trackedRequest{stats: stats}
+		atomic.AddInt64(&stats.inFlight, 1)
+		defer func() {
+			atomic.AddInt64(&stats.inFlight, -1)
+			switch {
+			case !t.isSignalled() || tracked.websocket || stats.probe:
+			case t.isForced() && r.Context().Err() != nil:
+				atomic.AddInt64(&t.cutOff, 1)
+			default:
+				atomic.AddInt64(&t.servedAfterSignal, 1)
+			}
+		}()
+		h(w, r.WithContext(context.WithValue(r.Context(), trackedRequestContextKey{}, tracked)))
+	}
+}
+
+// websocketOpened records a new websocket for the handler serving r
+func (t *drainTracker) websocketOpened(r *http.Request) {
+	if tracked, ok := r.Context().Value(trackedRequestContextKey{}).(*trackedRequest); ok {
+		tracked.websocket = true
+		atomic.AddInt64(&tracked.stats.websockets, 1)
+	}
+}
+
+// websocketClosed records the end of a websocket. clean is true when the close
+// handshake completed.
+func (t *drainTracker) websocketClosed(r *http.Request, clean bool) {
+	if tracked, ok := r.Context().Value(trackedRequestContextKey{}).(*trackedRequest); ok {
+		atomic.AddInt64(&tracked.stats.websockets, -1)
+	}
+	if !t.isSignalled() {
+		return
+	}
+	if clean {
+		atomic.AddInt64(&t.websocketsClosedCleanly, 1)
+	} else {
+		atomic.AddInt64(&t.websocketsClosedForcibly, 1)
+	}
+}
+
+func (t *drainTracker) sortedPaths() []string {
+	paths := make([]string, 0, len(t.handlers))
+	for p := range t.handlers {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// inFlight returns the total number of requests still being handled
+func (t *drainTracker) inFlight() int64 {
+	var n int64
+	for _, s := range t.handlers {
+		n += atomic.LoadInt64(&s.inFlight)
+	}
+	return n
+}
+
+// websockets returns the total number of open websockets
+func (t *drainTracker) websockets() int64 {
+	var n int64
+	for _, s := range t.handlers {
+		n += atomic.LoadInt64(&s.websockets)
+	}
+	return n
+}
+
+// logProgress logs the in-flight requests and open websockets of every busy handler
+func (t *drainTracker) logProgress(logger logr.Logger) {
+	total := int64(0)
+	for _, p := range t.sortedPaths() {
+		s := t.handlers[p]
+		inFlight, websockets := atomic.LoadInt64(&s.inFlight), atomic.LoadInt64(&s.websockets)
+		total += inFlight
+		if inFlight > 0 || websockets > 0 {
+			logger.Info("handler draining", "path", p, "inFlight", inFlight, "websockets", websockets)
+		}
+	}
+	logger.Info("drain progress", "inFlight", total, "servedAfterSignal", atomic.LoadInt64(&t.servedAfterSignal))
+}
+
+// logProgressUntil logs progress every interval until the context is done
+func (t *drainTracker) logProgressUntil(ctx context.Context, interval time.Duration, logger logr.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.logProgress(logger)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// summary reports how the drain went. Requests and websockets still open are
+// counted as cut off and forcibly closed respectively.
+func (t *drainTracker) summary() drainSummary {
+	s := drainSummary{
+		RequestsServedAfterSignal: atomic.LoadInt64(&t.servedAfterSignal),
+		RequestsCutOff:            atomic.LoadInt64(&t.cutOff),
+		WebsocketsClosedCleanly:   atomic.LoadInt64(&t.websocketsClosedCleanly),
+		WebsocketsClosedForcibly:  atomic.LoadInt64(&t.websocketsClosedForcibly),
+		InFlightByHandler:         map[string]int64{},
+	}
+	for p, h := range t.handlers {
+		if h.probe {
+			continue
+		}
+		inFlight, websockets := atomic.LoadInt64(&h.inFlight), atomic.LoadInt64(&h.websockets)
+		s.RequestsCutOff += inFlight - websockets
+		s.WebsocketsClosedForcibly += websockets
+		if inFlight > 0 {
+			s.InFlightByHandler[p] = inFlight
+		}
+	}
+	return s
+}
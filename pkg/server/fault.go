@@ -0,0 +1,273 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/aka-bo/loqu/pkg/util"
+)
+
+// Latency distributions supported by FaultProfile
+const (
+	LatencyNormal      = "normal"
+	LatencyExponential = "exponential"
+)
+
+// FaultProfile describes the faults injected into requests for a handler path.
+// Rates are probabilities between 0 and 1. In JSON, durations are strings
+// such as 30s.
+type FaultProfile struct {
+	Path string `json:"path" mapstructure:"path"`
+
+	ErrorRate   float64 `json:"errorRate,omitempty" mapstructure:"error-rate"`
+	ErrorStatus int     `json:"errorStatus,omitempty" mapstructure:"error-status"`
+
+	HangRate     float64       `json:"hangRate,omitempty" mapstructure:"hang-rate"`
+	HangDuration time.Duration `json:"hangDuration,omitempty" mapstructure:"hang"`
+
+	Latency       string        `json:"latency,omitempty" mapstructure:"latency"`
+	LatencyMean   time.Duration `json:"latencyMean,omitempty" mapstructure:"latency-mean"`
+	LatencyStdDev time.Duration `json:"latencyStdDev,omitempty" mapstructure:"latency-stddev"`
+}
+
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func parseDurationString(name, v string) (time.Duration, error) {
+	if len(v) == 0 {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return d, nil
+}
+
+// MarshalJSON writes the durations as strings such as "30s", the form taken
+// by --fault, rather than as nanoseconds
+func (p FaultProfile) MarshalJSON() ([]byte, error) {
+	type plain FaultProfile
+	return json.Marshal(struct {
+		plain
+		HangDuration  string `json:"hangDuration,omitempty"`
+		LatencyMean   string `json:"latencyMean,omitempty"`
+		LatencyStdDev string `json:"latencyStdDev,omitempty"`
+	}{
+		plain:         plain(p),
+		HangDuration:  durationString(p.HangDuration),
+		LatencyMean:   durationString(p.LatencyMean),
+		LatencyStdDev: durationString(p.LatencyStdDev),
+	})
+}
+
+// UnmarshalJSON reads the durations from strings, e.g. "hangDuration": "30s"
+func (p *FaultProfile) UnmarshalJSON(b []byte) error {
+	type plain FaultProfile
+	v := struct {
+		*plain
+		HangDuration  string `json:"hangDuration,omitempty"`
+		LatencyMean   string `json:"latencyMean,omitempty"`
+		LatencyStdDev string `json:"latencyStdDev,omitempty"`
+	}{plain: (*plain)(p)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	var err error
+	if p.HangDuration, err = parseDurationString("hangDuration", v.HangDuration); err != nil {
+		return err
+	}
+	if p.LatencyMean, err = parseDurationString("latencyMean", v.LatencyMean); err != nil {
+		return err
+	}
+	p.LatencyStdDev, err = parseDurationString("latencyStdDev", v.LatencyStdDev)
+	return err
+}
+
+// ParseFaultProfile parses a comma separated list of key=value pairs, e.g.
+// path=/,error-rate=0.05,error-status=500,hang-rate=0.01,hang=30s,latency=normal,latency-mean=100ms,latency-stddev=20ms
+func ParseFaultProfile(spec string) (FaultProfile, error) {
+	p := FaultProfile{}
+	for _, kv := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(parts) != 2 {
+			return p, fmt.Errorf("invalid fault setting %q, expected key=value", kv)
+		}
+		k, v := parts[0], parts[1]
+
+		var err error
+		switch k {
+		case "path":
+			p.Path = v
+		case "error-rate":
+			p.ErrorRate, err = strconv.ParseFloat(v, 64)
+		case "error-status":
+			p.ErrorStatus, err = strconv.Atoi(v)
+		case "hang-rate":
+			p.HangRate, err = strconv.ParseFloat(v, 64)
+		case "hang":
+			p.HangDuration, err = time.ParseDuration(v)
+		case "latency":
+			p.Latency = v
+		case "latency-mean":
+			p.LatencyMean, err = time.ParseDuration(v)
+		case "latency-stddev":
+			p.LatencyStdDev, err = time.ParseDuration(v)
+		default:
+			return p, fmt.Errorf("unknown fault setting %q", k)
+		}
+		if err != nil {
+			return p, fmt.Errorf("invalid value for fault setting %q: %v", k, err)
+		}
+	}
+	return p, p.Validate()
+}
+
+// Validate checks the profile for out of range or missing settings and fills in defaults
+func (p *FaultProfile) Validate() error {
+	if len(p.Path) == 0 {
+		return fmt.Errorf("fault profile requires a path")
+	}
+	if !isRate(p.ErrorRate) || !isRate(p.HangRate) || p.ErrorRate+p.HangRate > 1 {
+		return fmt.Errorf("fault profile for %s: rates must be between 0 and 1 and sum to at most 1", p.Path)
+	}
+	if p.ErrorRate > 0 && p.ErrorStatus == 0 {
+		p.ErrorStatus = http.StatusInternalServerError
+	}
+	if p.ErrorStatus != 0 && (p.ErrorStatus < 400 || p.ErrorStatus > 599) {
+		return fmt.Errorf("fault profile for %s: error-status must be between 400 and 599", p.Path)
+	}
+	if p.HangRate > 0 && p.HangDuration <= 0 {
+		return fmt.Errorf("fault profile for %s: hang-rate requires a hang duration", p.Path)
+	}
+	switch p.Latency {
+	case "", LatencyNormal, LatencyExponential:
+	default:
+		return fmt.Errorf("fault profile for %s: unsupported latency distribution %q, expected normal or exponential", p.Path, p.Latency)
+	}
+	if len(p.Latency) > 0 && p.LatencyMean <= 0 {
+		return fmt.Errorf("fault profile for %s: latency requires latency-mean", p.Path)
+	}
+	return nil
+}
+
+// isRate reports whether v is a probability, NaN never is
+func isRate(v float64) bool {
+	return !math.IsNaN(v) && v >= 0 && v <= 1
+}
+
+func (p *FaultProfile) latency() time.Duration {
+	var d float64
+	switch p.Latency {
+	case LatencyNormal:
+		d = rand.NormFloat64()*float64(p.LatencyStdDev) + float64(p.LatencyMean)
+	case LatencyExponential:
+		d = rand.ExpFloat64() * float64(p.LatencyMean)
+	}
+	if d < 0 {
+		return 0
+	}
+	return time.Duration(d)
+}
+
+// faultInjector holds the active fault profiles keyed by handler path
+type faultInjector struct {
+	mu       sync.RWMutex
+	profiles map[string]FaultProfile
+}
+
+func newFaultInjector(profiles []FaultProfile) *faultInjector {
+	f := &faultInjector{}
+	f.set(profiles)
+	return f
+}
+
+func (f *faultInjector) set(profiles []FaultProfile) {
+	m := map[string]FaultProfile{}
+	for _, p := range profiles {
+		m[p.Path] = p
+	}
+
+	f.mu.Lock()
+	f.profiles = m
+	f.mu.Unlock()
+}
+
+func (f *faultInjector) get(path string) (FaultProfile, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	p, ok := f.profiles[path]
+	return p, ok
+}
+
+// list returns the active profiles
+func (f *faultInjector) list() []FaultProfile {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	profiles := make([]FaultProfile, 0, len(f.profiles))
+	for _, p := range f.profiles {
+		profiles = append(profiles, p)
+	}
+	return profiles
+}
+
+// wrap injects the faults configured for path before calling h
+func (f *faultInjector) wrap(path string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := f.get(path)
+		if !ok {
+			h(w, r)
+			return
+		}
+
+		logger := util.WithID("Fault", r).WithValues("path", r.URL.Path, "profile", p.Path)
+
+		if len(p.Latency) > 0 {
+			d := p.latency()
+			logger.Info("Injecting fault", "fault", "latency", "distribution", p.Latency, "latency", d.String())
+			if !sleep(r, d, logger) {
+				return
+			}
+		}
+
+		roll := rand.Float64()
+		switch {
+		case roll < p.ErrorRate:
+			logger.Info("Injecting fault", "fault", "error", "status", p.ErrorStatus)
+			write(w, p.ErrorStatus, errorResponseCode("injected fault", p.ErrorStatus), logger)
+			return
+		case roll < p.ErrorRate+p.HangRate:
+			logger.Info("Injecting fault", "fault", "hang", "duration", p.HangDuration.String())
+			if !sleep(r, p.HangDuration, logger) {
+				return
+			}
+		}
+
+		h(w, r)
+	}
+}
+
+// sleep for d, returning false if the request was cancelled first
+func sleep(r *http.Request, d time.Duration, logger logr.Logger) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-r.Context().Done():
+		logger.Info("Request cancelled during injected delay", "delay", d.String())
+		return false
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFaultProfile(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    FaultProfile
+		wantErr string
+	}{
+		{spec: "path=/", want: FaultProfile{Path: "/"}},
+		{spec: "path=/,error-rate=0.05", want: FaultProfile{Path: "/", ErrorRate: 0.05, ErrorStatus: http.StatusInternalServerError}},
+		{spec: "path=/,error-rate=1,error-status=503", want: FaultProfile{Path: "/", ErrorRate: 1, ErrorStatus: 503}},
+		{spec: "path=/, hang-rate=0.5, hang=30s", want: FaultProfile{Path: "/", HangRate: 0.5, HangDuration: 30 * time.Second}},
+		{spec: "path=/echo,latency=normal,latency-mean=100ms,latency-stddev=20ms",
+			want: FaultProfile{Path: "/echo", Latency: LatencyNormal, LatencyMean: 100 * time.Millisecond, LatencyStdDev: 20 * time.Millisecond}},
+		{spec: "path=/,latency=exponential,latency-mean=1s", want: FaultProfile{Path: "/", Latency: LatencyExponential, LatencyMean: time.Second}},
+		{spec: "error-rate=0.1", wantErr: "requires a path"},
+		{spec: "path=/,error-rate=NaN", wantErr: "rates must be between 0 and 1"},
+		{spec: "path=/,hang-rate=NaN,hang=1s", wantErr: "rates must be between 0 and 1"},
+		{spec: "path=/,error-rate=Inf", wantErr: "rates must be between 0 and 1"},
+		{spec: "path=/,error-rate=-Inf", wantErr: "rates must be between 0 and 1"},
+		{spec: "path=/,error-rate=-0.1", wantErr: "rates must be between 0 and 1"},
+		{spec: "path=/,error-rate=0.6,hang-rate=0.6,hang=1s", wantErr: "sum to at most 1"},
+		{spec: "path=/,error-rate=0.1,error-status=200", wantErr: "between 400 and 599"},
+		{spec: "path=/,hang-rate=0.1", wantErr: "requires a hang duration"},
+		{spec: "path=/,latency=uniform,latency-mean=1s", wantErr: "unsupported latency distribution"},
+		{spec: "path=/,latency=normal", wantErr: "requires latency-mean"},
+		{spec: "path=/,hang=soon", wantErr: `invalid value for fault setting "hang"`},
+		{spec: "path=/,error-rate=often", wantErr: `invalid value for fault setting "error-rate"`},
+		{spec: "path=/,color=red", wantErr: "unknown fault setting"},
+		{spec: "path=/,error-rate", wantErr: "expected key=value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseFaultProfile(tt.spec)
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseFaultProfile(%q) = %v, want an error containing %q", tt.spec, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFaultProfile(%q) returned an error: %v", tt.spec, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFaultProfile(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFaultProfileJSON(t *testing.T) {
+	p := FaultProfile{Path: "/", HangRate: 0.1, HangDuration: 30 * time.Second, Latency: LatencyNormal, LatencyMean: 100 * time.Millisecond}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"path":"/","hangRate":0.1,"latency":"normal","hangDuration":"30s","latencyMean":"100ms"}`
+	if string(b) != want {
+		t.Errorf("json.Marshal() = %s, want %s", b, want)
+	}
+
+	var decoded FaultProfile
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != p {
+		t.Errorf("round trip = %+v, want %+v", decoded, p)
+	}
+
+	tests := []struct {
+		name    string
+		in      string
+		wantErr string
+	}{
+		{name: "bad duration", in: `{"path":"/","hangDuration":"soon"}`, wantErr: "invalid hangDuration"},
+		{name: "nanoseconds", in: `{"path":"/","latencyMean":100000000}`, wantErr: "cannot unmarshal number"},
+		{name: "bad rate", in: `{"path":"/","errorRate":"high"}`, wantErr: "cannot unmarshal string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p FaultProfile
+			err := json.Unmarshal([]byte(tt.in), &p)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("json.Unmarshal(%s) = %v, want an error containing %q", tt.in, err, tt.wantErr)
+			}
+		})
+	}
+}
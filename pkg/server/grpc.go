@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/glogr"
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/aka-bo/loqu/pkg/api/echo"
+	"github.com/aka-bo/loqu/pkg/util"
+)
+
+const defaultStreamInterval = time.Second
+
+// GRPC serves the Echo and grpc.health.v1 services. It follows the same
+// Start/Stop lifecycle as the http handlers.
+type GRPC struct {
+	echo.UnimplementedEchoServer
+
+	state *serverState
+
+	health  *health.Server
+	stopped stopSignal
+}
+
+// Register the Echo and health services with the grpc server
+func (g *GRPC) Register(s *grpc.Server) {
+	g.health = health.NewServer()
+	echo.RegisterEchoServer(s, g)
+	healthpb.RegisterHealthServer(s, g.health)
+}
+
+// Start marks all services as serving
+func (g *GRPC) Start() {
+	g.stopped.start()
+	g.health.Resume()
+	g.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	g.health.SetServingStatus(echo.Echo_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+}
+
+// Stop signals that the shutdown process has begun. Health checks will report
+// NOT_SERVING and open streams are ended.
+func (g *GRPC) Stop() {
+	g.health.Shutdown()
+	g.stopped.stop()
+}
+
+// Echo replies once with the received message
+func (g *GRPC) Echo(ctx context.Context, req *echo.EchoRequest) (*echo.EchoResponse, error) {
+	logger := grpcLogger(ctx)
+	if g.state.stopping() {
+		logger.Info("Shutdown signal received. processing will continue normally.")
+	}
+	return g.buildResponse(ctx, req.GetMessage(), 0), nil
+}
+
+// ServerStream replies with Count messages spaced at Interval. A count of 0
+// streams until the server begins shutting down.
+func (g *GRPC) ServerStream(req *echo.ServerStreamRequest, stream echo.Echo_ServerStreamServer) error {
+	logger := grpcLogger(stream.Context())
+
+	interval := req.GetInterval().AsDuration()
+	if interval <= 0 {
+		interval = defaultStreamInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for seq := int64(1); req.GetCount() == 0 || seq <= int64(req.GetCount()); seq++ {
+		if err := stream.Send(g.buildResponse(stream.Context(), req.GetMessage(), seq)); err != nil {
+			logger.Error(err, "send failed")
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			logger.Info("stream closed by client")
+			return stream.Context().Err()
+		case <-g.stopped.done():
+			return g.goingAway(logger)
+		}
+	}
+	return nil
+}
+
+// BidiStream replies to every message received on the stream
+func (g *GRPC) BidiStream(stream echo.Echo_BidiStreamServer) error {
+	logger := grpcLogger(stream.Context())
+
+	type received struct {
+		req *echo.EchoRequest
+		err error
+	}
+	recv := make(chan received)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			select {
+			case recv <- received{req: req, err: err}:
+			case <-stream.Context().Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var seq int64
+	for {
+		select {
+		case r := <-recv:
+			if r.err == io.EOF {
+				logger.Info("stream closed by client")
+				return nil
+			}
+			if r.err != nil {
+				logger.Error(r.err, "read failed")
+				return r.err
+			}
+			seq++
+			if logger.V(4).Enabled() {
+				logger.Info("message received", "message", r.req.GetMessage())
+			}
+			if err := stream.Send(g.buildResponse(stream.Context(), r.req.GetMessage(), seq)); err != nil {
+				logger.Error(err, "write failed")
+				return err
+			}
+		case <-g.stopped.done():
+			return g.goingAway(logger)
+		}
+	}
+}
+
+func (g *GRPC) goingAway(logger logr.Logger) error {
+	logger.Info("Shutdown signal received. ending stream.")
+	return status.Error(codes.Unavailable, "server is shutting down")
+}
+
+func (g *GRPC) buildResponse(ctx context.Context, message string, seq int64) *echo.EchoResponse {
+	resp := &echo.EchoResponse{
+		Id:       util.RequestIDFromContext(ctx),
+		Message:  message,
+		Sequence: seq,
+		Client:   &echo.ClientInfo{},
+		Server: &echo.ServerInfo{
+			Hostname: g.state.hostname,
+			Started:  timestamppb.New(g.state.lifecycle.Started()),
+			Stopping: g.state.stopping(),
+		},
+		Metadata: map[string]string{},
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		resp.Client.Address = p.Addr.String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for k, v := range md {
+			resp.Metadata[k] = strings.Join(v, ",")
+		}
+	}
+	return resp
+}
+
+// grpcRequestContext adds the x-request-id metadata value (or a new id) to the context
+func grpcRequestContext(ctx context.Context) context.Context {
+	id := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(util.KeyRequestID); len(v) > 0 {
+			id = v[0]
+		}
+	}
+	if len(id) == 0 {
+		id = util.NewRequestID()
+	}
+	return util.WithRequestID(ctx, id)
+}
+
+func grpcLogger(ctx context.Context) logr.Logger {
+	return glogr.New().WithName("GRPC").WithValues("RequestID", util.RequestIDFromContext(ctx))
+}
+
+func unaryLoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx = grpcRequestContext(ctx)
+	logger := grpcLogger(ctx).WithValues("method", info.FullMethod)
+	logger.Info("Handling request")
+
+	resp, err := handler(ctx, req)
+	logger.Info("Request complete", "code", status.Code(err).String())
+	return resp, err
+}
+
+func streamLoggingInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := grpcRequestContext(ss.Context())
+	logger := grpcLogger(ctx).WithValues("method", info.FullMethod)
+	logger.Info("Stream opened")
+
+	stream := &loggingServerStream{ServerStream: ss, ctx: ctx}
+	err := handler(srv, stream)
+	logger.Info("Stream closed", "code", status.Code(err).String(), "sent", atomic.LoadInt64(&stream.sent), "received", atomic.LoadInt64(&stream.received))
+	return err
+}
+
+type loggingServerStream struct {
+	grpc.ServerStream
+
+	ctx      context.Context
+	sent     int64
+	received int64
+}
+
+func (s *loggingServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *loggingServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.sent, 1)
+	}
+	return err
+}
+
+func (s *loggingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.received, 1)
+	}
+	return err
+}
+
+func newGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(unaryLoggingInterceptor),
+		grpc.ChainStreamInterceptor(streamLoggingInterceptor),
+	)
+	return grpc.NewServer(opts...)
+}
+
+// serveGRPC starts the grpc server on the given port. TLS is used when tlsConfig is not nil.
+func serveGRPC(port int, g *GRPC, tlsConfig *tls.Config, logger logr.Logger) *grpc.Server {
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	s := newGRPCServer(opts...)
+	g.Register(s)
+	g.Start()
+
+	addr := fmt.Sprintf(":%d", port)
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		logger.Info("Starting grpc server", "addr", addr, "tls", tlsConfig != nil)
+		if err := s.Serve(l); err != nil {
+			logger.Error(err, "grpc server exited with error")
+		}
+	}()
+	return s
+}
+
+// stopGRPC gracefully stops the grpc server, forcing it closed when the context is done
+func stopGRPC(ctx context.Context, s *grpc.Server, logger logr.Logger) {
+	logger.Info("commencing graceful shutdown of grpc server")
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Info("grpc server stopped")
+	case <-ctx.Done():
+		logger.Info("grpc server did not stop before the shutdown timeout, closing remaining connections")
+		s.Stop()
+	}
+}
@@ -9,7 +9,7 @@ import (
 
 //HealthCheck provides a handler for health check requests
 type HealthCheck struct {
-	serverInfo serverInfo
+	state *serverState
 
 	// stopChan chan bool
 }
@@ -19,16 +19,19 @@ func (h *HealthCheck) Handle(w http.ResponseWriter, r *http.Request) {
 	logger := util.WithID("Handle", r).WithValues("path", r.URL.Path)
 	logger.Info("Handling request")
 
-	if h.serverInfo.Stopping {
+	stopping := h.state.stopping()
+	if stopping {
 		logger.Info("Shutdown signal received. Handler will be returning an error code.")
 	}
 
 	b, err := json.Marshal(struct {
 		Healthy bool
+		Phase   Phase
 		Info    *response
 	}{
-		Healthy: true,
-		Info:    buildResponse(&h.serverInfo, r),
+		Healthy: !stopping,
+		Phase:   h.state.lifecycle.Phase(),
+		Info:    buildResponse(h.state, r),
 	})
 
 	w.Header().Set("Content-Type", "application/json")
@@ -40,7 +43,7 @@ func (h *HealthCheck) Handle(w http.ResponseWriter, r *http.Request) {
 
 	status := http.StatusOK
 
-	if h.serverInfo.Stopping {
+	if stopping {
 		status = http.StatusInternalServerError
 		logger.Info("Returning unhealthy because of shutdown signal")
 	}
@@ -55,6 +58,6 @@ func (h *HealthCheck) Start() {
 
 //Stop signals that the shutdown process has begun
 func (h *HealthCheck) Stop() {
-	h.serverInfo.Stopping = true
+	// the shutdown state is read from the shared lifecycle
 	// h.stopChan <- true
 }
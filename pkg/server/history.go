@@ -0,0 +1,283 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aka-bo/loqu/pkg/util"
+)
+
+const historyPath = "/_history"
+
+// redacted replaces the value of credential headers in recorded requests
+const redacted = "[REDACTED]"
+
+// credentialHeaders are redacted before a request is recorded, the history is
+// served to any client and the journal is written to disk
+var credentialHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"X-Api-Key",
+	"X-Auth-Token",
+}
+
+// redactHeaders returns h with the credential header values replaced. h is
+// copied when it has to change, the echoed response keeps the original.
+func redactHeaders(h http.Header) http.Header {
+	var out http.Header
+	for _, name := range credentialHeaders {
+		values, ok := h[name]
+		if !ok {
+			continue
+		}
+		if out == nil {
+			out = h.Clone()
+		}
+		masked := make([]string, len(values))
+		for i := range masked {
+			masked[i] = redacted
+		}
+		out[name] = masked
+	}
+	if out == nil {
+		return h
+	}
+	return out
+}
+
+// historyRecord is kept for every handled request. It embeds the echoed
+// response, or the request details for handlers that do not echo.
+type historyRecord struct {
+	*response
+	Status     int     `json:"status"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+type responseSlotKey struct{}
+
+// responseSlot receives the response built by buildResponse while a recorded
+// request is handled
+type responseSlot struct {
+	resp *response
+}
+
+// recorder keeps a record of every handled request in the history and the
+// journal, including injected faults, rejected parameters and aborted responses
+type recorder struct {
+	state         *serverState
+	excludeProbes bool
+}
+
+// wrap records the requests for path once h has returned. History queries
+// are never recorded, probes are left out when excludeProbes is set.
+func (rc *recorder) wrap(path string, h http.HandlerFunc) http.HandlerFunc {
+	if (rc.state.history == nil && rc.state.journal == nil) || path == historyPath || (rc.excludeProbes && isProbePath(path)) {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		slot := &responseSlot{}
+		start := time.Now()
+		defer func() {
+			resp := slot.resp
+			if resp == nil {
+				resp = newResponse(rc.state, r, "")
+				resp.Timestamp = start
+			}
+			recorded := *resp
+			recorded.Request.Headers = redactHeaders(resp.Request.Headers)
+			record := &historyRecord{
+				response:   &recorded,
+				Status:     rec.statusCode(),
+				DurationMs: float64(time.Since(start)) / float64(time.Millisecond),
+			}
+			rc.state.history.add(record)
+			rc.state.journal.recordResponse(record)
+		}()
+		h(rec, r.WithContext(context.WithValue(r.Context(), responseSlotKey{}, slot)))
+	}
+}
+
+// history keeps the most recent records in a ring buffer
+type history struct {
+	mu      sync.RWMutex
+	records []*historyRecord
+	next    int
+	full    bool
+}
+
+func newHistory(size int) *history {
+	if size <= 0 {
+		return nil
+	}
+	return &history{records: make([]*historyRecord, size)}
+}
+
+// add keeps a record, replacing the oldest once the buffer is full. It is
+// safe to call on a nil history.
+func (h *history) add(r *historyRecord) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records[h.next] = r
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// historyFilter selects records, empty fields match everything
+type historyFilter struct {
+	path      string
+	method    string
+	requestID string
+	client    string
+	since     time.Time
+	until     time.Time
+	limit     int
+}
+
+func (f *historyFilter) matches(r *historyRecord) bool {
+	switch {
+	case len(f.path) > 0 && f.path != r.Request.Path:
+		return false
+	case len(f.method) > 0 && !strings.EqualFold(f.method, r.Request.Method):
+		return false
+	case len(f.requestID) > 0 && f.requestID != r.ID:
+		return false
+	case len(f.client) > 0 && f.client != r.Client.Address && f.client != clientHost(r.Client.Address):
+		return false
+	case !f.since.IsZero() && r.Timestamp.Before(f.since):
+		return false
+	case !f.until.IsZero() && r.Timestamp.After(f.until):
+		return false
+	}
+	return true
+}
+
+func clientHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// query returns the matching records, oldest first. When a limit is set the
+// most recent matches are kept.
+func (h *history) query(f *historyFilter) []*historyRecord {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var ordered []*historyRecord
+	if h.full {
+		ordered = append(ordered, h.records[h.next:]...)
+	}
+	ordered = append(ordered, h.records[:h.next]...)
+
+	matches := []*historyRecord{}
+	for _, r := range ordered {
+		if f.matches(r) {
+			matches = append(matches, r)
+		}
+	}
+	if f.limit > 0 && len(matches) > f.limit {
+		matches = matches[len(matches)-f.limit:]
+	}
+	return matches
+}
+
+// parseTime accepts an RFC 3339 timestamp or a duration before now, e.g. 5m
+func parseTime(v string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected an RFC 3339 timestamp or a duration such as 5m", v)
+}
+
+func parseHistoryFilter(r *http.Request) (*historyFilter, error) {
+	q := r.URL.Query()
+	f := &historyFilter{
+		path:      q.Get("path"),
+		method:    q.Get("method"),
+		requestID: q.Get("id"),
+		client:    q.Get("client"),
+	}
+
+	now := time.Now()
+	var err error
+	if v := q.Get("since"); len(v) > 0 {
+		if f.since, err = parseTime(v, now); err != nil {
+			return nil, err
+		}
+	}
+	if v := q.Get("until"); len(v) > 0 {
+		if f.until, err = parseTime(v, now); err != nil {
+			return nil, err
+		}
+	}
+	if v := q.Get("limit"); len(v) > 0 {
+		if f.limit, err = strconv.Atoi(v); err != nil || f.limit < 0 {
+			return nil, fmt.Errorf("invalid limit %q, expected a positive number", v)
+		}
+	}
+	return f, nil
+}
+
+// History serves the recorded responses. The path, method, id, client, since,
+// until and limit query parameters filter the results.
+type History struct {
+	state *serverState
+}
+
+// Handle history queries
+func (h *History) Handle(w http.ResponseWriter, r *http.Request) {
+	logger := util.WithID("Handle", r).WithValues("path", r.URL.Path)
+	logger.Info("Handling request")
+
+	if h.state.history == nil {
+		write(w, http.StatusNotFound, errorResponseCode("request history is disabled", http.StatusNotFound), logger)
+		return
+	}
+
+	f, err := parseHistoryFilter(r)
+	if err != nil {
+		logger.Error(err, "Invalid history query")
+		write(w, http.StatusBadRequest, errorResponseCode(err.Error(), http.StatusBadRequest), logger)
+		return
+	}
+
+	records := h.state.history.query(f)
+	logger.Info("History queried", "query", r.URL.RawQuery, "matches", len(records))
+
+	_, pretty := r.URL.Query()["pretty"]
+	b, err := marshal(records, pretty)
+	if err != nil {
+		logger.Error(err, "Unable to marshal history")
+		write(w, http.StatusInternalServerError, errorResponse("unable to marshal history"), logger)
+		return
+	}
+	write(w, http.StatusOK, b, logger)
+}
+
+// Start the History handler
+func (h *History) Start() {
+	// no-op
+}
+
+// Stop signals that the shutdown process has begun
+func (h *History) Stop() {
+	// no-op, history stays available while draining
+}
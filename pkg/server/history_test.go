@@ -0,0 +1,188 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func historyOf(size, n int) *history {
+	h := newHistory(size)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		method := http.MethodGet
+		if i%2 == 1 {
+			method = http.MethodPost
+		}
+		h.add(&historyRecord{response: &response{
+			ID:        string(rune('a' + i)),
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Request:   requestInfo{Path: "/", Method: method},
+		}})
+	}
+	return h
+}
+
+func ids(records []*historyRecord) string {
+	s := ""
+	for _, r := range records {
+		s += r.ID
+	}
+	return s
+}
+
+func TestHistoryQuery(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		size   int
+		added  int
+		filter historyFilter
+		want   string
+	}{
+		{name: "empty", size: 3, want: ""},
+		{name: "partly filled", size: 5, added: 3, want: "abc"},
+		{name: "exactly full", size: 3, added: 3, want: "abc"},
+		{name: "wrapped around", size: 3, added: 5, want: "cde"},
+		{name: "wrapped around twice", size: 3, added: 7, want: "efg"},
+		{name: "limit keeps the newest", size: 5, added: 5, filter: historyFilter{limit: 2}, want: "de"},
+		{name: "limit above the matches", size: 5, added: 2, filter: historyFilter{limit: 10}, want: "ab"},
+		{name: "method", size: 5, added: 5, filter: historyFilter{method: "post"}, want: "bd"},
+		{name: "method and limit", size: 5, added: 5, filter: historyFilter{method: "GET", limit: 2}, want: "ce"},
+		{name: "since and until", size: 5, added: 5, filter: historyFilter{since: start.Add(time.Second), until: start.Add(3 * time.Second)}, want: "bcd"},
+		{name: "request id", size: 5, added: 5, filter: historyFilter{requestID: "c"}, want: "c"},
+		{name: "other path", size: 5, added: 5, filter: historyFilter{path: "/sse"}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(historyOf(tt.size, tt.added).query(&tt.filter)); got != tt.want {
+				t.Errorf("query() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHistoryFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    historyFilter
+		wantErr bool
+	}{
+		{name: "empty", query: ""},
+		{name: "fields", query: "path=/post&method=POST&id=abc&client=10.0.0.1&limit=5",
+			want: historyFilter{path: "/post", method: "POST", requestID: "abc", client: "10.0.0.1", limit: 5}},
+		{name: "rfc 3339", query: "since=2020-01-01T00:00:00Z&until=2020-01-01T00:01:00.5Z",
+			want: historyFilter{since: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), until: time.Date(2020, 1, 1, 0, 1, 0, 5e8, time.UTC)}},
+		{name: "bad since", query: "since=yesterday", wantErr: true},
+		{name: "negative duration", query: "since=-5m", wantErr: true},
+		{name: "bad until", query: "until=2020-13-01", wantErr: true},
+		{name: "bad limit", query: "limit=ten", wantErr: true},
+		{name: "negative limit", query: "limit=-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHistoryFilter(httptest.NewRequest(http.MethodGet, historyPath+"?"+tt.query, nil))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseHistoryFilter(%q) = %+v, want an error", tt.query, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseHistoryFilter(%q) returned an error: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("parseHistoryFilter(%q) = %+v, want %+v", tt.query, *got, tt.want)
+			}
+		})
+	}
+
+	t.Run("relative since", func(t *testing.T) {
+		before := time.Now()
+		f, err := parseHistoryFilter(httptest.NewRequest(http.MethodGet, historyPath+"?since=5m", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.since.Before(before.Add(-5*time.Minute)) || f.since.After(time.Now().Add(-5*time.Minute)) {
+			t.Errorf("since=5m parsed as %s, want five minutes before now", f.since)
+		}
+	})
+}
+
+func TestHistoryHandle(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		query string
+		code  int
+	}{
+		{name: "disabled", size: 0, code: http.StatusNotFound},
+		{name: "query", size: 5, query: "limit=2", code: http.StatusOK},
+		{name: "bad query", size: 5, query: "until=later", code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &History{state: &serverState{history: historyOf(tt.size, 3)}}
+			w := httptest.NewRecorder()
+			h.Handle(w, httptest.NewRequest(http.MethodGet, historyPath+"?"+tt.query, nil))
+			if w.Code != tt.code {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+		})
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	original := http.Header{
+		"Authorization": {"Bearer secret"},
+		"Cookie":        {"session=1", "theme=dark"},
+		"Accept":        {"*/*"},
+	}
+	got := redactHeaders(original)
+	want := http.Header{
+		"Authorization": {redacted},
+		"Cookie":        {redacted, redacted},
+		"Accept":        {"*/*"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("redactHeaders() = %v, want %v", got, want)
+	}
+	if original.Get("Authorization") != "Bearer secret" {
+		t.Errorf("redactHeaders() changed the echoed headers: %v", original)
+	}
+
+	plain := http.Header{"Accept": {"*/*"}}
+	if got := redactHeaders(plain); !reflect.DeepEqual(got, plain) {
+		t.Errorf("redactHeaders() = %v, want %v", got, plain)
+	}
+}
+
+func TestRecorderRedactsCredentials(t *testing.T) {
+	state := &serverState{history: newHistory(5), lifecycle: NewLifecycle()}
+	rec := &recorder{state: state}
+	h := rec.wrap("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	h(httptest.NewRecorder(), r)
+
+	records := state.history.query(&historyFilter{})
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	if got := records[0].Request.Headers.Get("Authorization"); got != redacted {
+		t.Errorf("recorded Authorization = %q, want %q", got, redacted)
+	}
+	if records[0].Status != http.StatusNoContent {
+		t.Errorf("recorded status = %d, want %d", records[0].Status, http.StatusNoContent)
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("the request headers were changed")
+	}
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/glogr"
+	"github.com/go-logr/logr"
+)
+
+// Journal record types
+const (
+	journalResponse  = "response"
+	journalLifecycle = "lifecycle"
+	journalDrain     = "drain"
+)
+
+// journalRecord is a single line of the journal
+type journalRecord struct {
+	Type       string         `json:"type"`
+	Time       time.Time      `json:"time"`
+	Hostname   string         `json:"hostname"`
+	Response   *historyRecord `json:"response,omitempty"`
+	Transition *Transition    `json:"transition,omitempty"`
+	Drain      *drainSummary  `json:"drain,omitempty"`
+}
+
+// journal appends responses and lifecycle events to a JSON Lines file. The
+// file is rotated once it reaches maxSize, keeping maxFiles rotated files
+// named path.1 (newest) to path.N.
+type journal struct {
+	path     string
+	hostname string
+	maxSize  int64
+	maxFiles int
+	logger   logr.Logger
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func openJournal(path, hostname string, maxSize int64, maxFiles int) (*journal, error) {
+	j := &journal{
+		path:     path,
+		hostname: hostname,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		logger:   glogr.New().WithName("Journal").WithValues("path", path),
+	}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *journal) open() error {
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	j.file, j.size = f, info.Size()
+	return nil
+}
+
+// rotate shifts the rotated files up by one, dropping the oldest, and starts a new file
+func (j *journal) rotate() error {
+	if err := j.file.Close(); err != nil {
+		j.logger.Error(err, "unable to close journal before rotating")
+	}
+
+	if j.maxFiles > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", j.path, j.maxFiles))
+		for i := j.maxFiles - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", j.path, i), fmt.Sprintf("%s.%d", j.path, i+1))
+		}
+		if err := os.Rename(j.path, j.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(j.path); err != nil {
+		return err
+	}
+
+	j.logger.Info("journal rotated", "size", j.size, "maxFiles", j.maxFiles)
+	return j.open()
+}
+
+func (j *journal) write(rec *journalRecord) {
+	if j == nil {
+		return
+	}
+	rec.Hostname = j.hostname
+	b, err := json.Marshal(rec)
+	if err != nil {
+		j.logger.Error(err, "unable to marshal journal record", "type", rec.Type)
+		return
+	}
+	b = append(b, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return
+	}
+	if j.maxSize > 0 && j.size > 0 && j.size+int64(len(b)) > j.maxSize {
+		if err := j.rotate(); err != nil {
+			j.logger.Error(err, "unable to rotate journal, records will be dropped")
+			j.file = nil
+			return
+		}
+	}
+	n, err := j.file.Write(b)
+	j.size += int64(n)
+	if err != nil {
+		j.logger.Error(err, "unable to write journal record", "type", rec.Type)
+	}
+}
+
+// recordResponse appends a handled request with its credential headers
+// redacted. It is safe to call on a nil journal.
+func (j *journal) recordResponse(r *historyRecord) {
+	if j == nil {
+		return
+	}
+	resp := *r.response
+	resp.Request.Headers = redactHeaders(resp.Request.Headers)
+	rec := *r
+	rec.response = &resp
+	j.write(&journalRecord{Type: journalResponse, Time: r.Timestamp, Response: &rec})
+}
+
+// recordDrain appends the drain summary
+func (j *journal) recordDrain(s drainSummary) {
+	j.write(&journalRecord{Type: journalDrain, Time: time.Now(), Drain: &s})
+}
+
+// watch appends every lifecycle transition until close is called
+func (j *journal) watch(l *Lifecycle) {
+	if j == nil {
+		return
+	}
+	transitions, cancel := l.Subscribe()
+	j.stop, j.done = make(chan struct{}), make(chan struct{})
+
+	record := func(t Transition) {
+		j.write(&journalRecord{Type: journalLifecycle, Time: t.At, Transition: &t})
+	}
+	go func() {
+		defer close(j.done)
+		defer cancel()
+		for {
+			select {
+			case t := <-transitions:
+				record(t)
+			case <-j.stop:
+				// the final transitions may still be buffered
+				for {
+					select {
+					case t := <-transitions:
+						record(t)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// close stops watching the lifecycle and closes the file
+func (j *journal) close() {
+	if j == nil {
+		return
+	}
+	if j.stop != nil {
+		close(j.stop)
+		<-j.done
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file != nil {
+		if err := j.file.Close(); err != nil {
+			j.logger.Error(err, "unable to close journal")
+		}
+		j.file = nil
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// journalLine is a journal record as read back from the file
+type journalLine struct {
+	Type     string `json:"type"`
+	Hostname string `json:"hostname"`
+	Response *struct {
+		ID      string      `json:"id"`
+		Request requestInfo `json:"request"`
+		Status  int         `json:"status"`
+	} `json:"response"`
+	Transition *Transition   `json:"transition"`
+	Drain      *drainSummary `json:"drain"`
+}
+
+// readJournal returns the records of a journal file, nil when it does not exist
+func readJournal(t *testing.T, path string) []journalLine {
+	t.Helper()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	records := []journalLine{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec journalLine
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func responseRecord(id string) *historyRecord {
+	return &historyRecord{
+		response: &response{ID: id, Timestamp: time.Now(), Request: requestInfo{Path: "/", Method: http.MethodGet, Headers: http.Header{}}},
+		Status:   http.StatusOK,
+	}
+}
+
+// recordSize is the length of a journal line written by responseRecord
+func recordSize(t *testing.T, hostname string) int64 {
+	b, err := json.Marshal(&journalRecord{Type: journalResponse, Time: time.Now(), Hostname: hostname, Response: responseRecord("r00")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int64(len(b) + 1)
+}
+
+func TestJournalRotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		perFile  int64
+		maxFiles int
+		written  int
+		// ids of the records in path, path.1, path.2, ...
+		want [][]string
+	}{
+		{name: "below the limit", perFile: 4, maxFiles: 2, written: 3, want: [][]string{{"r00", "r01", "r02"}}},
+		{name: "rotated once", perFile: 2, maxFiles: 2, written: 3, want: [][]string{{"r02"}, {"r00", "r01"}}},
+		{name: "oldest dropped", perFile: 2, maxFiles: 2, written: 7, want: [][]string{{"r06"}, {"r04", "r05"}, {"r02", "r03"}}},
+		{name: "no rotated files kept", perFile: 2, maxFiles: 0, written: 5, want: [][]string{{"r04"}}},
+		{name: "rotation disabled", perFile: 0, maxFiles: 2, written: 5, want: [][]string{{"r00", "r01", "r02", "r03", "r04"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal.jsonl")
+			j, err := openJournal(path, "test", tt.perFile*recordSize(t, "test"), tt.maxFiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.written; i++ {
+				j.recordResponse(responseRecord(fmt.Sprintf("r%02d", i)))
+			}
+			j.close()
+
+			for i := 0; i <= tt.maxFiles+1; i++ {
+				file := path
+				if i > 0 {
+					file = fmt.Sprintf("%s.%d", path, i)
+				}
+				var ids []string
+				for _, rec := range readJournal(t, file) {
+					ids = append(ids, rec.Response.ID)
+				}
+				var want []string
+				if i < len(tt.want) {
+					want = tt.want[i]
+				}
+				if strings.Join(ids, ",") != strings.Join(want, ",") {
+					t.Errorf("%s holds %v, want %v", filepath.Base(file), ids, want)
+				}
+			}
+		})
+	}
+}
+
+func TestJournalAppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	size := recordSize(t, "test")
+	for _, id := range []string{"r00", "r01"} {
+		j, err := openJournal(path, "test", 2*size, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		j.recordResponse(responseRecord(id))
+		j.close()
+	}
+
+	j, err := openJournal(path, "test", 2*size, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.recordResponse(responseRecord("r02"))
+	j.close()
+
+	if got := len(readJournal(t, path)); got != 1 {
+		t.Errorf("%d records after reopening a full journal, want 1", got)
+	}
+	if got := len(readJournal(t, path+".1")); got != 2 {
+		t.Errorf("%d rotated records, want 2", got)
+	}
+}
+
+func TestJournalLifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := openJournal(path, "test", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLifecycle()
+	j.watch(l)
+
+	l.Transition(PhaseReady)
+	l.Transition(PhaseDraining)
+	j.recordDrain(drainSummary{RequestsServedAfterSignal: 3})
+	l.Transition(PhaseTerminating)
+	l.Transition(PhaseStopped)
+	j.close()
+
+	var transitions []string
+	var drain *drainSummary
+	for _, rec := range readJournal(t, path) {
+		if rec.Hostname != "test" {
+			t.Errorf("record hostname = %q, want test", rec.Hostname)
+		}
+		switch rec.Type {
+		case journalLifecycle:
+			transitions = append(transitions, rec.Transition.From.String()+">"+rec.Transition.To.String())
+		case journalDrain:
+			drain = rec.Drain
+		}
+	}
+	want := "starting>ready,ready>draining,draining>terminating,terminating>stopped"
+	if got := strings.Join(transitions, ","); got != want {
+		t.Errorf("lifecycle records %s, want %s", got, want)
+	}
+	if drain == nil || drain.RequestsServedAfterSignal != 3 {
+		t.Errorf("drain record = %+v, want the summary", drain)
+	}
+}
+
+func TestJournalRedactsCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := openJournal(path, "test", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := responseRecord("r00")
+	rec.Request.Headers.Set("Authorization", "Bearer secret")
+	rec.Request.Headers.Set("Cookie", "session=secret")
+	rec.Request.Headers.Set("Accept", "*/*")
+	j.recordResponse(rec)
+	j.close()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "secret") {
+		t.Errorf("journal contains a credential: %s", b)
+	}
+	records := readJournal(t, path)
+	if len(records) != 1 || records[0].Response.Request.Headers.Get("Accept") != "*/*" || records[0].Response.Request.Headers.Get("Authorization") != redacted {
+		t.Errorf("journal records = %+v, want the headers with credentials redacted", records)
+	}
+	if rec.Request.Headers.Get("Authorization") != "Bearer secret" {
+		t.Errorf("recording changed the caller's headers")
+	}
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/glogr"
+	"github.com/go-logr/logr"
+)
+
+// Phase is a step in the server lifecycle
+type Phase int32
+
+// Lifecycle phases, in order
+const (
+	PhaseStarting Phase = iota
+	PhaseReady
+	PhaseDraining
+	PhaseTerminating
+	PhaseStopped
+)
+
+var phaseNames = map[Phase]string{
+	PhaseStarting:    "starting",
+	PhaseReady:       "ready",
+	PhaseDraining:    "draining",
+	PhaseTerminating: "terminating",
+	PhaseStopped:     "stopped",
+}
+
+func (p Phase) String() string {
+	if name, ok := phaseNames[p]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// MarshalJSON writes the phase name
+func (p Phase) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON reads a phase name
+func (p *Phase) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return err
+	}
+	for phase, n := range phaseNames {
+		if n == name {
+			*p = phase
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown phase %q", name)
+}
+
+// allowedTransitions lists the phases each phase may move to
+var allowedTransitions = map[Phase][]Phase{
+	PhaseStarting:    {PhaseReady, PhaseDraining, PhaseStopped},
+	PhaseReady:       {PhaseDraining, PhaseStopped},
+	PhaseDraining:    {PhaseReady, PhaseTerminating, PhaseStopped},
+	PhaseTerminating: {PhaseStopped},
+}
+
+// Transition describes a change from one phase to another
+type Transition struct {
+	From Phase     `json:"from"`
+	To   Phase     `json:"to"`
+	At   time.Time `json:"at"`
+}
+
+// Lifecycle is the single source of truth for the server phase. It is safe for
+// concurrent use, the current phase can be read without locking.
+type Lifecycle struct {
+	phase int32
+
+	mu          sync.Mutex
+	timestamps  map[Phase]time.Time
+	subscribers map[chan Transition]struct{}
+	logger      logr.Logger
+}
+
+// NewLifecycle returns a Lifecycle in the starting phase
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{
+		phase:       int32(PhaseStarting),
+		timestamps:  map[Phase]time.Time{PhaseStarting: time.Now()},
+		subscribers: map[chan Transition]struct{}{},
+		logger:      glogr.New().WithName("Lifecycle"),
+	}
+}
+
+// Phase returns the current phase
+func (l *Lifecycle) Phase() Phase {
+	return Phase(atomic.LoadInt32(&l.phase))
+}
+
+// Stopping reports whether the shutdown process has begun
+func (l *Lifecycle) Stopping() bool {
+	return l.Phase() >= PhaseDraining
+}
+
+// Transition moves the lifecycle to the given phase. It returns false, and
+// leaves the phase unchanged, if the transition is not allowed.
+func (l *Lifecycle) Transition(to Phase) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	from := l.Phase()
+	if !transitionAllowed(from, to) {
+		l.logger.Info("ignoring invalid phase transition", "from", from.String(), "to", to.String())
+		return false
+	}
+
+	t := Transition{From: from, To: to, At: time.Now()}
+	atomic.StoreInt32(&l.phase, int32(to))
+	l.timestamps[to] = t.At
+	l.logger.Info("phase transition", "from", from.String(), "to", to.String(), "sincePrevious", t.At.Sub(l.timestamps[from]).String())
+
+	for ch := range l.subscribers {
+		select {
+		case ch <- t:
+		default:
+			l.logger.Info("subscriber is not keeping up, dropping transition", "to", to.String())
+		}
+	}
+	return true
+}
+
+func transitionAllowed(from, to Phase) bool {
+	for _, p := range allowedTransitions[from] {
+		if p == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe returns a channel that receives every subsequent transition, and
+// a function that cancels the subscription
+func (l *Lifecycle) Subscribe() (<-chan Transition, func()) {
+	ch := make(chan Transition, 16)
+
+	l.mu.Lock()
+	l.subscribers[ch] = struct{}{}
+	l.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			delete(l.subscribers, ch)
+			l.mu.Unlock()
+		})
+	}
+}
+
+// Timestamps returns the time each phase was most recently entered, keyed by phase name
+func (l *Lifecycle) Timestamps() map[string]time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ts := make(map[string]time.Time, len(l.timestamps))
+	for p, t := range l.timestamps {
+		ts[p.String()] = t
+	}
+	return ts
+}
+
+// EnteredAt returns the time the phase was most recently entered
+func (l *Lifecycle) EnteredAt(p Phase) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t, ok := l.timestamps[p]
+	return t, ok
+}
+
+// Started returns the time the lifecycle was created
+func (l *Lifecycle) Started() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.timestamps[PhaseStarting]
+}
+
+// stopSignal is closed when a handler is stopped and replaced when it is
+// started again, so a cancelled drain can return handlers to service
+type stopSignal struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// start opens a new signal unless the current one is still open
+func (s *stopSignal) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch == nil || isClosed(s.ch) {
+		s.ch = make(chan struct{})
+	}
+}
+
+// stop closes the current signal
+func (s *stopSignal) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch != nil && !isClosed(s.ch) {
+		close(s.ch)
+	}
+}
+
+// done returns a channel that is closed once stop is called
+func (s *stopSignal) done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ch
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestLifecycleTransition(t *testing.T) {
+	tests := []struct {
+		name string
+		path []Phase
+		to   Phase
+		ok   bool
+	}{
+		{name: "starting to ready", to: PhaseReady, ok: true},
+		{name: "starting to draining", to: PhaseDraining, ok: true},
+		{name: "starting to stopped", to: PhaseStopped, ok: true},
+		{name: "starting to terminating", to: PhaseTerminating},
+		{name: "starting to starting", to: PhaseStarting},
+		{name: "ready to draining", path: []Phase{PhaseReady}, to: PhaseDraining, ok: true},
+		{name: "ready to stopped", path: []Phase{PhaseReady}, to: PhaseStopped, ok: true},
+		{name: "ready to terminating", path: []Phase{PhaseReady}, to: PhaseTerminating},
+		{name: "ready to starting", path: []Phase{PhaseReady}, to: PhaseStarting},
+		{name: "ready to ready", path: []Phase{PhaseReady}, to: PhaseReady},
+		{name: "draining cancelled", path: []Phase{PhaseReady, PhaseDraining}, to: PhaseReady, ok: true},
+		{name: "draining to terminating", path: []Phase{PhaseReady, PhaseDraining}, to: PhaseTerminating, ok: true},
+		{name: "draining to draining", path: []Phase{PhaseReady, PhaseDraining}, to: PhaseDraining},
+		{name: "terminating to stopped", path: []Phase{PhaseReady, PhaseDraining, PhaseTerminating}, to: PhaseStopped, ok: true},
+		{name: "terminating to ready", path: []Phase{PhaseReady, PhaseDraining, PhaseTerminating}, to: PhaseReady},
+		{name: "terminating to draining", path: []Phase{PhaseReady, PhaseDraining, PhaseTerminating}, to: PhaseDraining},
+		{name: "stopped is final", path: []Phase{PhaseStopped}, to: PhaseReady},
+		{name: "unknown phase", to: Phase(42)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLifecycle()
+			for _, p := range tt.path {
+				if !l.Transition(p) {
+					t.Fatalf("setting up: transition to %s refused", p)
+				}
+			}
+			from := l.Phase()
+			if got := l.Transition(tt.to); got != tt.ok {
+				t.Fatalf("Transition(%s) from %s = %v, want %v", tt.to, from, got, tt.ok)
+			}
+			want := from
+			if tt.ok {
+				want = tt.to
+			}
+			if l.Phase() != want {
+				t.Errorf("phase = %s, want %s", l.Phase(), want)
+			}
+			if stopping := want >= PhaseDraining; l.Stopping() != stopping {
+				t.Errorf("Stopping() = %v in %s", l.Stopping(), want)
+			}
+		})
+	}
+}
+
+func TestLifecycleTimestamps(t *testing.T) {
+	l := NewLifecycle()
+	started := l.Started()
+	if ts := l.Timestamps(); len(ts) != 1 || !ts["starting"].Equal(started) {
+		t.Fatalf("Timestamps() = %v, want only starting", ts)
+	}
+	if _, ok := l.EnteredAt(PhaseReady); ok {
+		t.Fatalf("EnteredAt(ready) reported a time before the server was ready")
+	}
+
+	l.Transition(PhaseReady)
+	firstReady, _ := l.EnteredAt(PhaseReady)
+	l.Transition(PhaseDraining)
+	draining, _ := l.EnteredAt(PhaseDraining)
+	l.Transition(PhaseReady)
+	ready, _ := l.EnteredAt(PhaseReady)
+
+	if firstReady.Before(started) || draining.Before(firstReady) || ready.Before(draining) {
+		t.Errorf("timestamps out of order: started %s, ready %s, draining %s, ready again %s", started, firstReady, draining, ready)
+	}
+	ts := l.Timestamps()
+	if len(ts) != 3 || !ts["ready"].Equal(ready) || !ts["draining"].Equal(draining) {
+		t.Errorf("Timestamps() = %v, want the most recent entry of starting, ready and draining", ts)
+	}
+	if !l.Started().Equal(started) {
+		t.Errorf("Started() changed from %s to %s", started, l.Started())
+	}
+}
+
+func TestLifecycleSubscribe(t *testing.T) {
+	l := NewLifecycle()
+	ch, cancel := l.Subscribe()
+
+	l.Transition(PhaseReady)
+	l.Transition(PhaseTerminating) // refused, not delivered
+	l.Transition(PhaseDraining)
+
+	for _, want := range []Transition{{From: PhaseStarting, To: PhaseReady}, {From: PhaseReady, To: PhaseDraining}} {
+		got := <-ch
+		if got.From != want.From || got.To != want.To {
+			t.Errorf("received %s -> %s, want %s -> %s", got.From, got.To, want.From, want.To)
+		}
+		if entered, _ := l.EnteredAt(got.To); !got.At.Equal(entered) {
+			t.Errorf("transition to %s at %s, EnteredAt says %s", got.To, got.At, entered)
+		}
+	}
+
+	cancel()
+	cancel()
+	l.Transition(PhaseTerminating)
+	select {
+	case got := <-ch:
+		t.Errorf("received %s -> %s after cancelling the subscription", got.From, got.To)
+	default:
+	}
+}
+
+func TestLifecycleConcurrent(t *testing.T) {
+	const subscribers, workers = 4, 6
+
+	l := NewLifecycle()
+	l.Transition(PhaseReady)
+
+	type subscription struct {
+		ch     <-chan Transition
+		cancel func()
+	}
+	subs := make([]subscription, subscribers)
+	for i := range subs {
+		subs[i].ch, subs[i].cancel = l.Subscribe()
+	}
+
+	// workers race to drain and cancel the drain, at most one wins each step
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, p := range []Phase{PhaseDraining, PhaseReady} {
+				if l.Transition(p) {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				}
+				_ = l.Phase()
+				_ = l.Timestamps()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, s := range subs {
+		s.cancel()
+		previous := PhaseReady
+		for n := 0; n < succeeded; n++ {
+			tr := <-s.ch
+			if tr.From != previous || !transitionAllowed(tr.From, tr.To) {
+				t.Fatalf("subscriber %d: transition %d was %s -> %s after %s", i, n, tr.From, tr.To, previous)
+			}
+			previous = tr.To
+		}
+		if previous != l.Phase() {
+			t.Errorf("subscriber %d ended in %s, lifecycle is %s", i, previous, l.Phase())
+		}
+		select {
+		case tr := <-s.ch:
+			t.Errorf("subscriber %d: unexpected transition %s -> %s", i, tr.From, tr.To)
+		default:
+		}
+	}
+}
+
+func TestStopSignal(t *testing.T) {
+	var s stopSignal
+
+	s.start()
+	first := s.done()
+	if signalled(first) {
+		t.Fatal("done() is closed after start")
+	}
+	s.start()
+	if s.done() != first {
+		t.Error("start replaced a signal that was still open")
+	}
+
+	s.stop()
+	s.stop()
+	if !signalled(first) {
+		t.Fatal("done() is open after stop")
+	}
+
+	s.start()
+	second := s.done()
+	if second == first || signalled(second) {
+		t.Error("start after stop did not re-arm the signal")
+	}
+	if !signalled(first) {
+		t.Error("re-arming reopened the old signal")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-s.done()
+		}()
+	}
+	s.stop()
+	wg.Wait()
+}
+
+func signalled(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// trackingListener counts the connections it has accepted until they are
+// closed. Unlike http.Server.Shutdown it also sees hijacked connections such
+// as websockets and h2c.
+type trackingListener struct {
+	net.Listener
+
+	open int64
+	wg   sync.WaitGroup
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&l.open, 1)
+	l.wg.Add(1)
+	return &trackedConn{Conn: c, listener: l}, nil
+}
+
+// Open returns the number of accepted connections that have not been closed
+func (l *trackingListener) Open() int64 {
+	return atomic.LoadInt64(&l.open)
+}
+
+// wait blocks until every accepted connection has been closed or the context is done
+func (l *trackingListener) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type trackedConn struct {
+	net.Conn
+
+	listener *trackingListener
+	once     sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		atomic.AddInt64(&c.listener.open, -1)
+		c.listener.wg.Done()
+	})
+	return err
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "loqu"
+
+// metrics holds the Prometheus collectors served on /metrics
+type metrics struct {
+	registry *prometheus.Registry
+
+	requests          *prometheus.CounterVec
+	requestDuration   *prometheus.HistogramVec
+	connStates        *prometheus.CounterVec
+	websocketMessages *prometheus.CounterVec
+}
+
+func newMetrics(state *serverState, drain *drainTracker) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Number of http requests handled, by handler path, method and status code.",
+		}, []string{"path", "method", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle http requests, by handler path, method and status code.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2.5, 12),
+		}, []string{"path", "method", "code"}),
+		connStates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_connection_state_transitions_total",
+			Help:      "Number of http connection state transitions, by new state.",
+		}, []string{"state"}),
+		websocketMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "websocket_messages_echoed_total",
+			Help:      "Number of websocket messages echoed, by message type.",
+		}, []string{"type"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.connStates,
+		m.websocketMessages,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "websockets_active",
+			Help:      "Number of open websockets.",
+		}, func() float64 {
+			return float64(drain.websockets())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Number of http requests being handled, including open websockets.",
+		}, func() float64 {
+			return float64(drain.inFlight())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "lifecycle_phase",
+			Help:      "The current lifecycle phase: 0 starting, 1 ready, 2 draining, 3 terminating, 4 stopped.",
+		}, func() float64 {
+			return float64(state.lifecycle.Phase())
+		}),
+	)
+
+	// one series per phase, set to 1 for the current phase
+	for p := PhaseStarting; p <= PhaseStopped; p++ {
+		phase := p
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "lifecycle_phase_active",
+			Help:        "Set to 1 for the current lifecycle phase.",
+			ConstLabels: prometheus.Labels{"phase": phase.String()},
+		}, func() float64 {
+			if state.lifecycle.Phase() == phase {
+				return 1
+			}
+			return 0
+		}))
+	}
+	return m
+}
+
+// watchListener reports the connections open on the listener, including hijacked ones
+func (m *metrics) watchListener(l *trackingListener) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "connections_active",
+		Help:      "Number of open connections accepted by the http listener.",
+	}, func() float64 {
+		return float64(l.Open())
+	}))
+}
+
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *metrics) connState(state http.ConnState) {
+	m.connStates.WithLabelValues(state.String()).Inc()
+}
+
+func (m *metrics) websocketMessage(messageType int) {
+	m.websocketMessages.WithLabelValues(messageTypeString(messageType)).Inc()
+}
+
+// wrap records the count and duration of requests for path. Requests that
+// panic, e.g. an aborted response, are still counted.
+func (m *metrics) wrap(path string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		defer func() {
+			code := strconv.Itoa(rec.statusCode())
+			m.requests.WithLabelValues(path, r.Method, code).Inc()
+			m.requestDuration.WithLabelValues(path, r.Method, code).Observe(time.Since(start).Seconds())
+		}()
+		h(rec, r)
+	}
+}
+
+// statusRecorder remembers the status code written by a handler. It passes
+// Flush and Hijack through so streaming and websocket handlers keep working.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int32
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	atomic.CompareAndSwapInt32(&s.status, 0, int32(code))
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	atomic.CompareAndSwapInt32(&s.status, 0, http.StatusOK)
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		atomic.CompareAndSwapInt32(&s.status, 0, http.StatusOK)
+		f.Flush()
+	}
+}
+
+// Hijack returns http.ErrNotSupported when the underlying writer cannot be
+// hijacked, e.g. for HTTP/2 requests
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		atomic.CompareAndSwapInt32(&s.status, 0, http.StatusSwitchingProtocols)
+	}
+	return conn, rw, err
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *statusRecorder) statusCode() int {
+	if code := atomic.LoadInt32(&s.status); code != 0 {
+		return int(code)
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aka-bo/loqu/pkg/util"
+)
+
+// Draining behaviors for a probe
+const (
+	DrainingPass      = "pass"
+	DrainingFail      = "fail"
+	DrainingFailAfter = "fail-after"
+)
+
+// DrainingBehavior controls how a probe responds once the server is draining
+type DrainingBehavior struct {
+	Mode  string
+	After time.Duration
+}
+
+func (d DrainingBehavior) String() string {
+	if d.Mode == DrainingFailAfter {
+		return fmt.Sprintf("%s=%s", d.Mode, d.After)
+	}
+	return d.Mode
+}
+
+// ParseDrainingBehavior parses pass, fail or fail-after=N where N is a number
+// of seconds or a duration such as 10s
+func ParseDrainingBehavior(v string) (DrainingBehavior, error) {
+	switch {
+	case v == DrainingPass || v == DrainingFail:
+		return DrainingBehavior{Mode: v}, nil
+	case strings.HasPrefix(v, DrainingFailAfter+"="):
+		s := strings.TrimPrefix(v, DrainingFailAfter+"=")
+		after, err := time.ParseDuration(s)
+		if err != nil {
+			seconds, serr := strconv.Atoi(s)
+			if serr != nil {
+				return DrainingBehavior{}, fmt.Errorf("invalid draining behavior %q, expected fail-after=N seconds", v)
+			}
+			after = time.Duration(seconds) * time.Second
+		}
+		if after < 0 {
+			return DrainingBehavior{}, fmt.Errorf("invalid draining behavior %q, fail-after must not be negative", v)
+		}
+		return DrainingBehavior{Mode: DrainingFailAfter, After: after}, nil
+	}
+	return DrainingBehavior{}, fmt.Errorf("invalid draining behavior %q, expected pass, fail or fail-after=N", v)
+}
+
+// probeCheck is a single named check reported by a Probe
+type probeCheck struct {
+	name  string
+	check func() error
+}
+
+// probePaths are polled by the kubelet and load balancers rather than clients,
+// they are left out of the drain summary
+var probePaths = map[string]bool{
+	"/healthcheck": true,
+	"/livez":       true,
+	"/readyz":      true,
+	"/startupz":    true,
+}
+
+func isProbePath(path string) bool {
+	return probePaths[path]
+}
+
+// Probe serves a Kubernetes style health endpoint such as /livez or /readyz.
+// It responds 200 "ok" when every check passes, or a per-check breakdown when
+// the verbose query parameter is set. Checks can be skipped with ?exclude=name.
+type Probe struct {
+	state    *serverState
+	name     string
+	checks   []probeCheck
+	draining DrainingBehavior
+}
+
+func newProbe(state *serverState, name string, draining DrainingBehavior, requireReady bool) *Probe {
+	p := &Probe{state: state, name: name, draining: draining}
+	p.checks = append(p.checks, probeCheck{name: "ping", check: func() error { return nil }})
+	if requireReady {
+		p.checks = append(p.checks, probeCheck{name: "started", check: p.checkStarted})
+	}
+	// only readiness can be flipped through the admin API
+	if name == "readyz" {
+		p.checks = append(p.checks, probeCheck{name: "admin", check: p.checkAdmin})
+	}
+	p.checks = append(p.checks, probeCheck{name: "shutdown", check: p.checkShutdown})
+	return p
+}
+
+func (p *Probe) checkStarted() error {
+	if p.state.lifecycle.Phase() == PhaseStarting {
+		return fmt.Errorf("server is starting")
+	}
+	return nil
+}
+
+func (p *Probe) checkAdmin() error {
+	if p.state.markedUnready() {
+		return fmt.Errorf("server was marked unready through the admin API")
+	}
+	return nil
+}
+
+func (p *Probe) checkShutdown() error {
+	if !p.state.stopping() {
+		return nil
+	}
+
+	switch p.draining.Mode {
+	case DrainingFail:
+		return fmt.Errorf("server is %s", p.state.lifecycle.Phase())
+	case DrainingFailAfter:
+		since, ok := p.state.lifecycle.EnteredAt(PhaseDraining)
+		if ok && time.Since(since) >= p.draining.After {
+			return fmt.Errorf("server has been draining for more than %s", p.draining.After)
+		}
+	}
+	return nil
+}
+
+// Handle probe requests
+func (p *Probe) Handle(w http.ResponseWriter, r *http.Request) {
+	logger := util.WithID("Handle", r).WithValues("path", r.URL.Path)
+	logger.Info("Handling request")
+
+	excluded := map[string]bool{}
+	for _, name := range r.URL.Query()["exclude"] {
+		excluded[name] = true
+	}
+	_, verbose := r.URL.Query()["verbose"]
+
+	var out bytes.Buffer
+	var failed []string
+	for _, c := range p.checks {
+		if excluded[c.name] {
+			fmt.Fprintf(&out, "[+]%s excluded: ok\n", c.name)
+			continue
+		}
+		if err := c.check(); err != nil {
+			failed = append(failed, c.name)
+			fmt.Fprintf(&out, "[-]%s failed: %v\n", c.name, err)
+			continue
+		}
+		fmt.Fprintf(&out, "[+]%s ok\n", c.name)
+	}
+
+	status := http.StatusOK
+	if len(failed) > 0 {
+		status = http.StatusInternalServerError
+		fmt.Fprintf(&out, "%s check failed\n", p.name)
+		logger.Info("Returning unhealthy", "failed", failed, "phase", p.state.lifecycle.Phase().String(), "draining", p.draining.String())
+	} else {
+		fmt.Fprintf(&out, "%s check passed\n", p.name)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	switch {
+	case verbose:
+		w.Write(out.Bytes())
+	case len(failed) > 0:
+		fmt.Fprintf(w, "%s check failed\n", p.name)
+	default:
+		fmt.Fprint(w, "ok")
+	}
+}
+
+// Start the Probe
+func (p *Probe) Start() {
+	// no-op
+}
+
+// Stop signals that the shutdown process has begun
+func (p *Probe) Stop() {
+	// no-op, the shutdown state is read from the shared lifecycle
+}
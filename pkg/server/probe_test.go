@@ -0,0 +1,132 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseDrainingBehavior(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    DrainingBehavior
+		wantErr bool
+	}{
+		{in: "pass", want: DrainingBehavior{Mode: DrainingPass}},
+		{in: "fail", want: DrainingBehavior{Mode: DrainingFail}},
+		{in: "fail-after=10", want: DrainingBehavior{Mode: DrainingFailAfter, After: 10 * time.Second}},
+		{in: "fail-after=1m30s", want: DrainingBehavior{Mode: DrainingFailAfter, After: 90 * time.Second}},
+		{in: "fail-after=0", want: DrainingBehavior{Mode: DrainingFailAfter}},
+		{in: "fail-after=-5", wantErr: true},
+		{in: "fail-after=-5s", wantErr: true},
+		{in: "fail-after=soon", wantErr: true},
+		{in: "fail-after", wantErr: true},
+		{in: "FAIL", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDrainingBehavior(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseDrainingBehavior(%q) = %v, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDrainingBehavior(%q) returned an error: %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDrainingBehavior(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeVerbose(t *testing.T) {
+	tests := []struct {
+		name     string
+		probe    string
+		ready    bool
+		phases   []Phase
+		unready  bool
+		draining DrainingBehavior
+		query    string
+		code     int
+		body     string
+	}{
+		{
+			name: "readyz while starting", probe: "readyz", ready: true, query: "verbose",
+			code: http.StatusInternalServerError,
+			body: "[+]ping ok\n[-]started failed: server is starting\n[+]admin ok\n[+]shutdown ok\nreadyz check failed\n",
+		},
+		{
+			name: "readyz ready", probe: "readyz", ready: true, phases: []Phase{PhaseReady}, query: "verbose",
+			code: http.StatusOK,
+			body: "[+]ping ok\n[+]started ok\n[+]admin ok\n[+]shutdown ok\nreadyz check passed\n",
+		},
+		{
+			name: "readyz ready, terse", probe: "readyz", ready: true, phases: []Phase{PhaseReady},
+			code: http.StatusOK, body: "ok",
+		},
+		{
+			name: "readyz marked unready", probe: "readyz", ready: true, phases: []Phase{PhaseReady}, unready: true, query: "verbose",
+			code: http.StatusInternalServerError,
+			body: "[+]ping ok\n[+]started ok\n[-]admin failed: server was marked unready through the admin API\n[+]shutdown ok\nreadyz check failed\n",
+		},
+		{
+			name: "readyz marked unready, admin excluded", probe: "readyz", ready: true, phases: []Phase{PhaseReady}, unready: true, query: "verbose&exclude=admin",
+			code: http.StatusOK,
+			body: "[+]ping ok\n[+]started ok\n[+]admin excluded: ok\n[+]shutdown ok\nreadyz check passed\n",
+		},
+		{
+			name: "readyz draining, fail", probe: "readyz", ready: true, phases: []Phase{PhaseReady, PhaseDraining},
+			draining: DrainingBehavior{Mode: DrainingFail}, query: "verbose",
+			code: http.StatusInternalServerError,
+			body: "[+]ping ok\n[+]started ok\n[+]admin ok\n[-]shutdown failed: server is draining\nreadyz check failed\n",
+		},
+		{
+			name: "readyz draining, terse", probe: "readyz", ready: true, phases: []Phase{PhaseReady, PhaseDraining},
+			draining: DrainingBehavior{Mode: DrainingFail},
+			code:     http.StatusInternalServerError, body: "readyz check failed\n",
+		},
+		{
+			name: "livez draining, pass", probe: "livez", phases: []Phase{PhaseReady, PhaseDraining},
+			draining: DrainingBehavior{Mode: DrainingPass}, query: "verbose",
+			code: http.StatusOK,
+			body: "[+]ping ok\n[+]shutdown ok\nlivez check passed\n",
+		},
+		{
+			name: "livez draining, not failing yet", probe: "livez", phases: []Phase{PhaseReady, PhaseDraining},
+			draining: DrainingBehavior{Mode: DrainingFailAfter, After: time.Hour}, query: "verbose",
+			code: http.StatusOK,
+			body: "[+]ping ok\n[+]shutdown ok\nlivez check passed\n",
+		},
+		{
+			name: "livez draining, failing after", probe: "livez", phases: []Phase{PhaseReady, PhaseDraining},
+			draining: DrainingBehavior{Mode: DrainingFailAfter}, query: "verbose",
+			code: http.StatusInternalServerError,
+			body: "[+]ping ok\n[-]shutdown failed: server has been draining for more than 0s\nlivez check failed\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &serverState{lifecycle: NewLifecycle()}
+			for _, p := range tt.phases {
+				state.lifecycle.Transition(p)
+			}
+			state.setUnready(tt.unready)
+			p := newProbe(state, tt.probe, tt.draining, tt.ready)
+
+			w := httptest.NewRecorder()
+			p.Handle(w, httptest.NewRequest(http.MethodGet, "/"+tt.probe+"?"+tt.query, nil))
+			if w.Code != tt.code {
+				t.Errorf("status = %d, want %d", w.Code, tt.code)
+			}
+			if got := w.Body.String(); got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
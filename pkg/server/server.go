@@ -2,26 +2,82 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/go-logr/glogr"
 	"github.com/go-logr/logr"
 	"github.com/golang/glog"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
 
 	"github.com/aka-bo/loqu/pkg/util"
 )
 
+const drainLogInterval = time.Second
+
 // Options is used to configure the server
 type Options struct {
-	ShutdownDelaySeconds int
-	ListenPort           int
+	ShutdownDelaySeconds   int
+	ShutdownTimeoutSeconds int
+	ListenPort             int
+
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSSelfSigned bool
+	// TLSClientCAFile enables mutual TLS. Client certificates are required and verified against this bundle.
+	TLSClientCAFile string
+
+	// GRPCPort enables the grpc Echo and health services when greater than 0
+	GRPCPort int
+
+	// TCPEchoPort and UDPEchoPort enable raw echo listeners when greater than 0
+	TCPEchoPort int
+	UDPEchoPort int
+
+	// Draining behavior of the /livez, /readyz and /startupz probes
+	LivezDraining    DrainingBehavior
+	ReadyzDraining   DrainingBehavior
+	StartupzDraining DrainingBehavior
+
+	// SSERate is the default number of events per second sent on /sse
+	SSERate float64
+
+	// HistorySize is the number of responses kept for /_history, 0 disables it
+	HistorySize int
+	// HistoryExcludeProbes leaves probe requests out of the history and journal
+	HistoryExcludeProbes bool
+
+	// HistoryFile enables a JSON Lines journal of responses and lifecycle
+	// events, rotated at HistoryFileMaxSize bytes keeping HistoryFileMaxFiles
+	HistoryFile         string
+	HistoryFileMaxSize  int64
+	HistoryFileMaxFiles int
+
+	// AdminPort enables the admin API when greater than 0. The API has no
+	// authentication, AdminAddress is the interface it binds to.
+	AdminPort    int
+	AdminAddress string
+
+	// VersionLabel is reported in every response so clients can tell
+	// releases apart, e.g. during a rolling update or canary
+	VersionLabel string
+
+	// Faults are the fault injection profiles applied per handler path
+	Faults []FaultProfile
+
+	// H2C enables HTTP/2 over cleartext connections, both prior knowledge and upgrade
+	H2C bool
 }
 
 type clientInfo struct {
@@ -29,24 +85,74 @@ type clientInfo struct {
 }
 
 type serverInfo struct {
-	Hostname string    `json:"hostname"`
-	Started  time.Time `json:""`
-	Stopping bool      `json:"stopping"`
+	Hostname string               `json:"hostname"`
+	Version  string               `json:"version,omitempty"`
+	Started  time.Time            `json:""`
+	Stopping bool                 `json:"stopping"`
+	Phase    Phase                `json:"phase"`
+	Phases   map[string]time.Time `json:"phases"`
+}
+
+// serverState is shared by every handler
+type serverState struct {
+	hostname  string
+	version   string
+	lifecycle *Lifecycle
+
+	// history records every response built, nil when disabled
+	history *history
+	// journal persists every response built, nil when disabled
+	journal *journal
+
+	// unready is set through the admin API to fail readiness without draining
+	unready int32
+}
+
+func (s *serverState) stopping() bool {
+	return s.lifecycle.Stopping()
+}
+
+func (s *serverState) setUnready(unready bool) {
+	var v int32
+	if unready {
+		v = 1
+	}
+	atomic.StoreInt32(&s.unready, v)
+}
+
+func (s *serverState) markedUnready() bool {
+	return atomic.LoadInt32(&s.unready) == 1
+}
+
+// info captures the current server details for a response
+func (s *serverState) info() serverInfo {
+	return serverInfo{
+		Hostname: s.hostname,
+		Version:  s.version,
+		Started:  s.lifecycle.Started(),
+		Stopping: s.lifecycle.Stopping(),
+		Phase:    s.lifecycle.Phase(),
+		Phases:   s.lifecycle.Timestamps(),
+	}
 }
 
 type requestInfo struct {
 	Path    string      `json:"path"`
 	Query   string      `json:"query,omitempty"`
 	Method  string      `json:"method"`
+	Proto   string      `json:"proto"`
 	Body    string      `json:"body,omitempty"`
 	Headers http.Header `json:"headers"`
 }
 
 type response struct {
-	ID      string      `json:"id"`
-	Client  clientInfo  `json:"client"`
-	Server  serverInfo  `json:"server"`
-	Request requestInfo `json:"request"`
+	ID         string          `json:"id"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Client     clientInfo      `json:"client"`
+	Connection *connectionInfo `json:"connection,omitempty"`
+	Server     serverInfo      `json:"server"`
+	Request    requestInfo     `json:"request"`
+	TLS        *tlsInfo        `json:"tls,omitempty"`
 }
 
 //Handler provides lifecycle hooks for an HttpHandler
@@ -58,19 +164,29 @@ type Handler interface {
 
 type handlerMap map[string]Handler
 
-func (h handlerMap) register(mux *http.ServeMux) {
+func (h handlerMap) register(mux *http.ServeMux, faults *faultInjector, drain *drainTracker, m *metrics, rec *recorder) {
 	for k, v := range h {
 		v.Start()
-		mux.Handle(k, requestIDHandler(v.Handle))
+		mux.Handle(k, requestIDHandler(drain.wrap(k, m.wrap(k, rec.wrap(k, faults.wrap(k, v.Handle))))))
 	}
 }
 
 func requestIDHandler(h http.HandlerFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		h.ServeHTTP(w, r.WithContext(util.RequestContext(r)))
+		r = r.WithContext(util.RequestContext(r))
+		r = r.WithContext(connRequestContext(r))
+		defer trackStream(r)()
+		logClientCertificate(r)
+		h.ServeHTTP(w, r)
 	})
 }
 
+func (h handlerMap) start() {
+	for _, v := range h {
+		v.Start()
+	}
+}
+
 func (h handlerMap) shutdown() {
 	for _, v := range h {
 		v.Stop()
@@ -90,73 +206,292 @@ func Run(o *Options) {
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, syscall.SIGTERM, syscall.SIGINT)
 
-	serverInfo := serverInfo{
-		Hostname: host,
-		Started:  time.Now(),
+	state := &serverState{
+		hostname:  host,
+		version:   o.VersionLabel,
+		lifecycle: NewLifecycle(),
+		history:   newHistory(o.HistorySize),
 	}
 
+	if len(o.HistoryFile) > 0 {
+		state.journal, err = openJournal(o.HistoryFile, host, o.HistoryFileMaxSize, o.HistoryFileMaxFiles)
+		if err != nil {
+			panic(err)
+		}
+		logger.Info("journal enabled", "path", o.HistoryFile, "maxSize", o.HistoryFileMaxSize, "maxFiles", o.HistoryFileMaxFiles)
+		state.journal.watch(state.lifecycle)
+	}
+
+	drain := newDrainTracker()
+	metrics := newMetrics(state, drain)
 	handlers := handlerMap{
-		"/":            &Default{serverInfo: serverInfo},
-		"/echo":        &Echo{serverInfo: serverInfo, shutdownGracePeriodSeconds: o.ShutdownDelaySeconds - 1},
-		"/healthcheck": &HealthCheck{serverInfo: serverInfo},
+		"/":            &Default{state: state},
+		"/echo":        &Echo{state: state, shutdownGracePeriodSeconds: o.ShutdownDelaySeconds - 1, drain: drain, metrics: metrics},
+		"/healthcheck": &HealthCheck{state: state},
+		"/sse":         &SSE{state: state, rate: o.SSERate},
+		"/chunked":     &Chunked{state: state},
+		historyPath:    &History{state: state},
+		"/livez":       newProbe(state, "livez", o.LivezDraining, false),
+		"/readyz":      newProbe(state, "readyz", o.ReadyzDraining, true),
+		"/startupz":    newProbe(state, "startupz", o.StartupzDraining, true),
+	}
+
+	for _, f := range o.Faults {
+		if _, ok := handlers[f.Path]; !ok {
+			logger.Info("fault profile does not match a handler path and will be ignored", "path", f.Path)
+			continue
+		}
+		logger.Info("fault injection enabled", "profile", f)
 	}
+	faults := newFaultInjector(o.Faults)
 
 	mux := http.NewServeMux()
-	handlers.register(mux)
+	handlers.register(mux, faults, drain, metrics, &recorder{state: state, excludeProbes: o.HistoryExcludeProbes})
+	mux.Handle("/metrics", metrics.handler())
 	// mux.Handle("/demo", demoHandler())
 
 	addr := fmt.Sprintf(":%d", o.ListenPort)
+	conns := newConnTracker()
 	server := &http.Server{
-		Addr:    addr,
-		Handler: mux,
+		Addr:        addr,
+		Handler:     mux,
+		ConnContext: conns.connContext,
+		ConnState: func(c net.Conn, s http.ConnState) {
+			conns.connState(c, s)
+			metrics.connState(s)
+		},
+	}
+
+	if len(o.TLSClientCAFile) > 0 && !o.tlsEnabled() {
+		panic("mutual TLS requires a server certificate, use --tls-cert/--tls-key or --tls-self-signed")
+	}
+
+	useTLS := o.tlsEnabled()
+	if useTLS {
+		tlsConfig, err := o.tlsConfig(host)
+		if err != nil {
+			panic(err)
+		}
+		for _, cert := range tlsConfig.Certificates {
+			logger.Info("TLS certificate loaded", "selfSigned", o.TLSSelfSigned, "fingerprint", fingerprint(cert.Certificate[0]))
+		}
+		if tlsConfig.ClientCAs != nil {
+			logger.Info("Client certificates will be required", "ca", o.TLSClientCAFile)
+		}
+		server.TLSConfig = tlsConfig
+	}
+
+	var grpcHandler *GRPC
+	var grpcServer *grpc.Server
+	if o.GRPCPort > 0 {
+		var grpcTLS *tls.Config
+		if useTLS {
+			grpcTLS = server.TLSConfig.Clone()
+		}
+		grpcHandler = &GRPC{state: state}
+		grpcServer = serveGRPC(o.GRPCPort, grpcHandler, grpcTLS, logger)
 	}
 
 	server.RegisterOnShutdown(func() {
 		logger.Info("Shutdown() called on http.Server")
 	})
 
+	// ConfigureServer registers its own shutdown hook which sends GOAWAY to
+	// every open HTTP/2 connection, TLS and h2c alike.
+	h2s := &http2.Server{}
+	if err := http2.ConfigureServer(server, h2s); err != nil {
+		panic(err)
+	}
+	conns.trackTLSNextProto(server)
+	server.RegisterOnShutdown(conns.logGoAway)
+	if o.H2C {
+		server.Handler = conns.h2cHandler(h2c.NewHandler(mux, h2s))
+	}
+
+	var tcpEcho *TCPEcho
+	if o.TCPEchoPort > 0 {
+		tcpEcho = &TCPEcho{state: state}
+		tcpEcho.Start(o.TCPEchoPort)
+	}
+
+	var udpEcho *UDPEcho
+	if o.UDPEchoPort > 0 {
+		udpEcho = &UDPEcho{state: state}
+		udpEcho.Start(o.UDPEchoPort)
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	listener := &trackingListener{Listener: l}
+	metrics.watchListener(listener)
+
 	go func() {
-		logger.Info("Starting server", "addr", addr)
+		logger.Info("Starting server", "addr", addr, "tls", useTLS, "h2c", o.H2C)
 
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if useTLS {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Error(err, "server exited with error")
 		}
 	}()
 
-	sig := <-shutdown
+	adm := newAdmin(state, drain, faults, handlers)
+	var adminServer *http.Server
+	if o.AdminPort > 0 {
+		adminServer = adm.serve(o.AdminAddress, o.AdminPort)
+	}
 
-	logger.Info("signal received. signaling handlers and disabling keep-alives", "signal", sig.String())
-	server.SetKeepAlivesEnabled(false)
-	handlers.shutdown()
+	// every listener is bound at this point
+	state.lifecycle.Transition(PhaseReady)
+
+	for {
+		select {
+		case sig := <-shutdown:
+			logger.Info("signal received. signaling handlers and disabling keep-alives", "signal", sig.String())
+		case id := <-adm.drainRequests:
+			logger.Info("drain requested through the admin API. signaling handlers and disabling keep-alives", "RequestID", id)
+		}
 
-	logger.Info("shutting down with delay", "delay", o.ShutdownDelaySeconds)
-	<-time.After(time.Duration(o.ShutdownDelaySeconds) * time.Second)
+		adm.openCancel()
+		state.lifecycle.Transition(PhaseDraining)
+		drain.signal()
+		server.SetKeepAlivesEnabled(false)
+		handlers.shutdown()
+		if grpcHandler != nil {
+			grpcHandler.Stop()
+		}
+
+		logger.Info("shutting down with delay", "delay", o.ShutdownDelaySeconds)
+		delayCtx, cancelDelay := context.WithTimeout(context.Background(), time.Duration(o.ShutdownDelaySeconds)*time.Second)
+		cancelled := make(chan string, 1)
+		go func() {
+			select {
+			case id := <-adm.cancelRequests:
+				cancelled <- id
+				cancelDelay()
+			case <-delayCtx.Done():
+				// a cancel accepted just before the delay ran out still counts
+				if id, ok := adm.closeCancel(); ok {
+					cancelled <- id
+				} else {
+					close(cancelled)
+				}
+			}
+		}()
+		drain.logProgressUntil(delayCtx, drainLogInterval, logger)
+		cancelDelay()
+
+		id, ok := <-cancelled
+		if !ok {
+			break
+		}
+		logger.Info("drain cancelled through the admin API. restarting handlers and enabling keep-alives", "RequestID", id)
+		drain.resume()
+		server.SetKeepAlivesEnabled(true)
+		handlers.start()
+		if grpcHandler != nil {
+			grpcHandler.Start()
+		}
+		state.lifecycle.Transition(PhaseReady)
+	}
 	logger.Info("proceeding with shutdown")
+	state.lifecycle.Transition(PhaseTerminating)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if o.ShutdownTimeoutSeconds > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(o.ShutdownTimeoutSeconds)*time.Second)
+	}
+	defer cancel()
+	go drain.logProgressUntil(ctx, drainLogInterval, logger)
+
+	logger.Info("commencing graceful shutdown of web server", "timeout", o.ShutdownTimeoutSeconds, "openConnections", listener.Open())
+	conns.logOpen("connection open at shutdown")
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Info("graceful shutdown did not complete before the shutdown timeout, closing remaining connections", "error", err.Error())
+		conns.logOpen("connection forcibly closed")
+		drain.force()
+		server.Close()
+	}
+	conns.logOpen("connection still open after shutdown")
+
+	// Shutdown does not wait for hijacked connections (websockets, h2c), give
+	// them a chance to finish so GOAWAY and close frames reach the client.
+	if n := listener.Open(); n > 0 {
+		logger.Info("waiting for remaining connections to close", "openConnections", n)
+		if err := listener.wait(ctx); err != nil {
+			logger.Info("connections still open after shutdown timeout", "openConnections", listener.Open())
+		} else {
+			logger.Info("all connections closed")
+		}
+	}
 
-	logger.Info("commencing graceful shutdown of web server")
-	server.Shutdown(context.Background())
+	if grpcServer != nil {
+		stopGRPC(ctx, grpcServer, logger)
+	}
+	if tcpEcho != nil {
+		tcpEcho.Shutdown(ctx)
+	}
+	if udpEcho != nil {
+		udpEcho.Shutdown()
+	}
+
+	if adminServer != nil {
+		adminServer.Close()
+	}
+
+	summary := drain.summary()
+	if b, err := json.Marshal(summary); err != nil {
+		logger.Error(err, "unable to marshal the drain summary")
+	} else {
+		logger.Info("drain summary written to stdout")
+		fmt.Println(string(b))
+	}
+
+	state.journal.recordDrain(summary)
+	state.lifecycle.Transition(PhaseStopped)
+	state.journal.close()
 
 	glog.Flush()
 }
 
-func buildResponse(server *serverInfo, r *http.Request) *response {
+// buildResponse reads the request body and echoes the request. The response is
+// handed to the recorder wrapping the handler, if any.
+func buildResponse(state *serverState, r *http.Request) *response {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		panic(err)
 	}
+	resp := newResponse(state, r, string(body))
+	if slot, ok := r.Context().Value(responseSlotKey{}).(*responseSlot); ok {
+		slot.resp = resp
+	}
+	return resp
+}
+
+func newResponse(state *serverState, r *http.Request, body string) *response {
 	return &response{
-		ID: util.GetRequestID(r),
+		ID:        util.GetRequestID(r),
+		Timestamp: time.Now(),
 		Client: clientInfo{
 			Address: r.RemoteAddr,
 		},
-		Server: *server,
+		Connection: connectionFromRequest(r),
+		Server:     state.info(),
 		Request: requestInfo{
-			Body:    string(body),
+			Body:    body,
 			Path:    r.URL.Path,
 			Query:   r.URL.RawQuery,
 			Method:  r.Method,
+			Proto:   r.Proto,
 			Headers: r.Header,
 		},
+		TLS: buildTLSInfo(r),
 	}
 }
 
@@ -176,12 +511,16 @@ func write(w http.ResponseWriter, status int, v []byte, logger logr.Logger) {
 }
 
 func errorResponse(msg string) []byte {
+	return errorResponseCode(msg, http.StatusInternalServerError)
+}
+
+func errorResponseCode(msg string, code int) []byte {
 	v := &struct {
 		Message   string
 		ErrorCode int
 	}{
 		Message:   msg,
-		ErrorCode: http.StatusInternalServerError,
+		ErrorCode: code,
 	}
 
 	b, _ := json.Marshal(v)
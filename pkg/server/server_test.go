@@ -0,0 +1,14 @@
+package server
+
+import (
+	"flag"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// glog writes to files in the temp directory unless told otherwise
+	flag.Set("logtostderr", "true")
+	flag.Parse()
+	os.Exit(m.Run())
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aka-bo/loqu/pkg/util"
+)
+
+const maxSSERate = 1000
+
+// SSEEvent is the data of every event sent by the SSE handler
+type SSEEvent struct {
+	Hostname  string    `json:"hostname"`
+	Sequence  int64     `json:"sequence"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId"`
+	Phase     Phase     `json:"phase"`
+	Rate      float64   `json:"rate"`
+}
+
+// SSE streams server-sent events at a fixed rate until the client goes away
+// or the server starts draining. Sequence numbers are derived from the clock,
+// so they continue across reconnects and, when replicas run the same rate with
+// synchronized clocks, across replicas, and a client can tell how many events
+// it missed. Last-Event-ID is only used to log the missed events, streams are
+// not replayed.
+type SSE struct {
+	state *serverState
+	rate  float64
+
+	stopped stopSignal
+}
+
+// Start the SSE handler
+func (s *SSE) Start() {
+	s.stopped.start()
+}
+
+// Stop signals that the shutdown process has begun. Open streams are sent a final event and closed.
+func (s *SSE) Stop() {
+	s.stopped.stop()
+}
+
+// Handle SSE requests. The rate query parameter overrides the events per second.
+func (s *SSE) Handle(w http.ResponseWriter, r *http.Request) {
+	logger := util.WithID("Handle", r).WithValues("path", r.URL.Path)
+	logger.Info("Handling request")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		write(w, http.StatusInternalServerError, errorResponse("streaming is not supported"), logger)
+		return
+	}
+
+	rate := s.rate
+	if v := r.URL.Query().Get("rate"); len(v) > 0 {
+		var err error
+		if rate, err = strconv.ParseFloat(v, 64); err != nil || rate <= 0 || rate > maxSSERate {
+			write(w, http.StatusBadRequest, errorResponseCode(fmt.Sprintf("invalid rate %q, expected events per second between 0 and %d", v, maxSSERate), http.StatusBadRequest), logger)
+			return
+		}
+	}
+	interval := time.Duration(float64(time.Second) / rate)
+
+	if last := r.Header.Get("Last-Event-ID"); len(last) > 0 {
+		if seq, err := strconv.ParseInt(last, 10, 64); err == nil {
+			logger.Info("client resuming stream", "lastEventID", seq, "missed", sequenceAt(time.Now(), interval)-seq-1)
+		}
+	}
+
+	if s.state.stopping() {
+		logger.Info("Shutdown signal received. refusing new stream.")
+		write(w, http.StatusServiceUnavailable, errorResponseCode("server is shutting down", http.StatusServiceUnavailable), logger)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", time.Second.Milliseconds())
+	flusher.Flush()
+	logger.Info("stream opened", "rate", rate)
+
+	// align the ticker with the sequence clock
+	next := time.Unix(0, (sequenceAt(time.Now(), interval)+1)*int64(interval))
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+
+	var sent int64
+	stopped := s.stopped.done()
+	for {
+		select {
+		case now := <-timer.C:
+			if err := s.send(w, r, "message", sequenceAt(now, interval), rate, now); err != nil {
+				logger.Error(err, "write failed", "sent", sent)
+				return
+			}
+			flusher.Flush()
+			sent++
+			timer.Reset(time.Until(time.Unix(0, (sequenceAt(now, interval)+1)*int64(interval))))
+		case <-r.Context().Done():
+			logger.Info("stream closed by client", "sent", sent)
+			return
+		case <-stopped:
+			logger.Info("Shutdown signal received. sending final event and closing stream.", "sent", sent)
+			now := time.Now()
+			if err := s.send(w, r, "shutdown", sequenceAt(now, interval), rate, now); err != nil {
+				logger.Error(err, "unable to send final event")
+				return
+			}
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+func (s *SSE) send(w http.ResponseWriter, r *http.Request, event string, seq int64, rate float64, now time.Time) error {
+	b, err := json.Marshal(&SSEEvent{
+		Hostname:  s.state.hostname,
+		Sequence:  seq,
+		Time:      now,
+		RequestID: util.GetRequestID(r),
+		Phase:     s.state.lifecycle.Phase(),
+		Rate:      rate,
+	})
+	if err != nil {
+		return err
+	}
+	// the final event has no id so the client resumes after the last message
+	if event == "message" {
+		fmt.Fprintf(w, "id: %d\n", seq)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
+
+// sequenceAt numbers the intervals since the unix epoch
+func sequenceAt(t time.Time, interval time.Duration) int64 {
+	return t.UnixNano() / int64(interval)
+}
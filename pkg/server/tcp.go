@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/go-logr/glogr"
+	"github.com/go-logr/logr"
+
+	"github.com/aka-bo/loqu/pkg/util"
+)
+
+// TCPEcho is a raw TCP listener that writes back everything it reads
+type TCPEcho struct {
+	state *serverState
+
+	listener net.Listener
+	logger   logr.Logger
+
+	mu    sync.Mutex
+	conns map[string]*net.TCPConn
+	wg    sync.WaitGroup
+}
+
+// Start listening on the given port
+func (t *TCPEcho) Start(port int) {
+	t.logger = glogr.New().WithName("TCPEcho")
+	t.conns = map[string]*net.TCPConn{}
+
+	addr := fmt.Sprintf(":%d", port)
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	t.listener = l
+
+	go func() {
+		t.logger.Info("Starting tcp echo listener", "addr", addr)
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				t.logger.Error(err, "accept failed")
+				continue
+			}
+			t.wg.Add(1)
+			go t.handle(c.(*net.TCPConn))
+		}
+	}()
+}
+
+// Shutdown stops accepting connections and half-closes the open ones. Connections
+// the client has not closed when the context is done are reset.
+func (t *TCPEcho) Shutdown(ctx context.Context) {
+	t.logger.Info("closing tcp echo listener")
+	t.listener.Close()
+
+	t.mu.Lock()
+	for id, c := range t.conns {
+		t.logger.Info("Shutdown signal received. sending half-close.", "ConnectionID", id)
+		c.CloseWrite()
+	}
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.logger.Info("all tcp echo connections closed")
+	case <-ctx.Done():
+		t.mu.Lock()
+		for id, c := range t.conns {
+			t.logger.Info("connection still open after shutdown timeout, sending reset", "ConnectionID", id)
+			c.SetLinger(0)
+			c.Close()
+		}
+		t.mu.Unlock()
+	}
+}
+
+func (t *TCPEcho) handle(c *net.TCPConn) {
+	id := util.NewRequestID()
+	logger := t.logger.WithValues("ConnectionID", id, "client", c.RemoteAddr().String())
+
+	t.mu.Lock()
+	t.conns[id] = c
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		delete(t.conns, id)
+		t.mu.Unlock()
+		c.Close()
+		logger.Info("connection closed")
+		t.wg.Done()
+	}()
+
+	logger.Info("connection accepted", "local", c.LocalAddr().String())
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := c.Read(buf)
+		if n > 0 {
+			if t.state.stopping() {
+				logger.Info("Shutdown signal received. processing will continue normally.")
+			}
+			logger.Info("read", "bytes", n)
+			if logger.V(4).Enabled() {
+				logger.Info("data received", "data", string(buf[:n]))
+			}
+			if _, werr := c.Write(buf[:n]); werr != nil {
+				logConnError(logger, werr, "write failed")
+				return
+			}
+			logger.Info("write", "bytes", n)
+		}
+		if err == io.EOF {
+			logger.Info("half-close received")
+			if err := c.CloseWrite(); err != nil {
+				logConnError(logger, err, "half-close failed")
+				return
+			}
+			logger.Info("half-close sent")
+			return
+		}
+		if err != nil {
+			logConnError(logger, err, "read failed")
+			return
+		}
+	}
+}
+
+func logConnError(logger logr.Logger, err error, msg string) {
+	switch {
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		logger.Info("connection reset by peer", "error", err.Error())
+	case errors.Is(err, net.ErrClosed):
+		logger.Info("connection closed locally")
+	default:
+		logger.Error(err, msg)
+	}
+}
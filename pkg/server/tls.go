@@ -0,0 +1,195 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aka-bo/loqu/pkg/util"
+)
+
+type tlsInfo struct {
+	Version            string `json:"version"`
+	CipherSuite        string `json:"cipherSuite"`
+	ServerName         string `json:"serverName,omitempty"`
+	NegotiatedProtocol string `json:"negotiatedProtocol,omitempty"`
+
+	ClientCertificate *certificateInfo `json:"clientCertificate,omitempty"`
+}
+
+type certificateInfo struct {
+	Subject     string   `json:"subject"`
+	Issuer      string   `json:"issuer"`
+	DNSNames    []string `json:"dnsNames,omitempty"`
+	URIs        []string `json:"uris,omitempty"`
+	IPAddresses []string `json:"ipAddresses,omitempty"`
+	Emails      []string `json:"emails,omitempty"`
+	Fingerprint string   `json:"fingerprint"`
+}
+
+func (o *Options) tlsEnabled() bool {
+	return o.TLSSelfSigned || len(o.TLSCertFile) > 0 || len(o.TLSKeyFile) > 0
+}
+
+// tlsConfig builds the server TLS configuration. Certificates are loaded from
+// TLSCertFile/TLSKeyFile when provided, otherwise a self-signed certificate is
+// generated in memory for the given host.
+func (o *Options) tlsConfig(host string) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+
+	switch {
+	case len(o.TLSCertFile) > 0 || len(o.TLSKeyFile) > 0:
+		if len(o.TLSCertFile) == 0 || len(o.TLSKeyFile) == 0 {
+			return nil, errors.New("both a tls certificate and key must be provided")
+		}
+		cert, err = tls.LoadX509KeyPair(o.TLSCertFile, o.TLSKeyFile)
+	default:
+		cert, err = selfSignedCertificate(host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if len(o.TLSClientCAFile) > 0 {
+		pool, err := loadCertPool(o.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+func selfSignedCertificate(host string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: host, Organization: []string{"loqu"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{host, "localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+func fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+func buildTLSInfo(r *http.Request) *tlsInfo {
+	if r.TLS == nil {
+		return nil
+	}
+	return &tlsInfo{
+		Version:            tls.VersionName(r.TLS.Version),
+		CipherSuite:        tls.CipherSuiteName(r.TLS.CipherSuite),
+		ServerName:         r.TLS.ServerName,
+		NegotiatedProtocol: r.TLS.NegotiatedProtocol,
+		ClientCertificate:  buildCertificateInfo(verifiedClientCertificate(r)),
+	}
+}
+
+// verifiedClientCertificate returns the leaf of the first verified client chain, if any
+func verifiedClientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+func buildCertificateInfo(cert *x509.Certificate) *certificateInfo {
+	if cert == nil {
+		return nil
+	}
+
+	info := &certificateInfo{
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		DNSNames:    cert.DNSNames,
+		Emails:      cert.EmailAddresses,
+		Fingerprint: fingerprint(cert.Raw),
+	}
+	for _, u := range cert.URIs {
+		info.URIs = append(info.URIs, u.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	return info
+}
+
+func logClientCertificate(r *http.Request) {
+	info := buildCertificateInfo(verifiedClientCertificate(r))
+	if info == nil {
+		return
+	}
+	util.WithID("ClientCertificate", r).Info("Verified client certificate",
+		"subject", info.Subject,
+		"issuer", info.Issuer,
+		"dnsNames", info.DNSNames,
+		"uris", info.URIs,
+		"ipAddresses", info.IPAddresses,
+		"emails", info.Emails,
+		"fingerprint", info.Fingerprint)
+}
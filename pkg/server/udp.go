@@ -0,0 +1,137 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-logr/glogr"
+	"github.com/go-logr/logr"
+
+	"github.com/aka-bo/loqu/pkg/util"
+)
+
+const udpPeerIdleTimeout = time.Minute
+
+// UDPEcho writes every datagram back to its sender. Each remote address is
+// treated as a connection and given an ID until it has been idle for a minute.
+type UDPEcho struct {
+	state *serverState
+
+	conn   net.PacketConn
+	logger logr.Logger
+
+	mu    sync.Mutex
+	peers map[string]*udpPeer
+	done  chan struct{}
+}
+
+type udpPeer struct {
+	id       string
+	lastSeen time.Time
+}
+
+// Start listening on the given port
+func (u *UDPEcho) Start(port int) {
+	u.logger = glogr.New().WithName("UDPEcho")
+	u.peers = map[string]*udpPeer{}
+	u.done = make(chan struct{})
+
+	addr := fmt.Sprintf(":%d", port)
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		panic(err)
+	}
+	u.conn = conn
+
+	go u.expirePeers()
+	go func() {
+		u.logger.Info("Starting udp echo listener", "addr", addr)
+		buf := make([]byte, 64*1024)
+		for {
+			n, raddr, err := conn.ReadFrom(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				u.logger.Error(err, "read failed")
+				continue
+			}
+			u.echo(buf[:n], raddr)
+		}
+	}()
+}
+
+// Shutdown closes the listener. Datagrams are echoed until then, including while draining.
+func (u *UDPEcho) Shutdown() {
+	u.logger.Info("closing udp echo listener")
+	close(u.done)
+	u.conn.Close()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for addr, p := range u.peers {
+		u.logger.Info("connection closed", "ConnectionID", p.id, "client", addr)
+	}
+}
+
+func (u *UDPEcho) echo(data []byte, raddr net.Addr) {
+	logger := u.peerLogger(raddr)
+
+	if u.state.stopping() {
+		logger.Info("Shutdown signal received. processing will continue normally.")
+	}
+	logger.Info("read", "bytes", len(data))
+	if logger.V(4).Enabled() {
+		logger.Info("data received", "data", string(data))
+	}
+
+	n, err := u.conn.WriteTo(data, raddr)
+	if err != nil {
+		logger.Error(err, "write failed")
+		return
+	}
+	logger.Info("write", "bytes", n)
+}
+
+func (u *UDPEcho) peerLogger(raddr net.Addr) logr.Logger {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := raddr.String()
+	p, ok := u.peers[key]
+	if !ok {
+		p = &udpPeer{id: util.NewRequestID()}
+		u.peers[key] = p
+	}
+	p.lastSeen = time.Now()
+
+	logger := u.logger.WithValues("ConnectionID", p.id, "client", key)
+	if !ok {
+		logger.Info("connection accepted")
+	}
+	return logger
+}
+
+func (u *UDPEcho) expirePeers() {
+	ticker := time.NewTicker(udpPeerIdleTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-u.done:
+			return
+		case now := <-ticker.C:
+			u.mu.Lock()
+			for addr, p := range u.peers {
+				if now.Sub(p.lastSeen) > udpPeerIdleTimeout {
+					u.logger.Info("connection idle, forgetting peer", "ConnectionID", p.id, "client", addr, "idle", now.Sub(p.lastSeen).String())
+					delete(u.peers, addr)
+				}
+			}
+			u.mu.Unlock()
+		}
+	}
+}
@@ -10,24 +10,31 @@ import (
 
 //Echo handler wrapper
 type Echo struct {
-	serverInfo serverInfo
+	state *serverState
 
 	upgrader                   websocket.Upgrader
 	shutdownGracePeriodSeconds int
+	drain                      *drainTracker
+	metrics                    *metrics
+
+	stopped stopSignal
 }
 
 //Start the Echo... echo... echo
 func (e *Echo) Start() {
-	e.upgrader = websocket.Upgrader{}
+	e.stopped.start()
 }
 
-//Stop signals that the shutdown process has begun
+//Stop signals that the shutdown process has begun. Open websockets are sent a close message.
 func (e *Echo) Stop() {
-	e.serverInfo.Stopping = true
+	e.stopped.stop()
 }
 
-func (e *Echo) isRunning() bool {
-	return !e.serverInfo.Stopping
+func (e *Echo) gracePeriod() time.Duration {
+	if e.shutdownGracePeriodSeconds < 1 {
+		return time.Second
+	}
+	return time.Duration(e.shutdownGracePeriodSeconds) * time.Second
 }
 
 //Handle websocket requests by replying with the received message
@@ -41,13 +48,41 @@ func (e *Echo) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	defer c.Close()
-	for e.isRunning() {
+	e.drain.websocketOpened(r)
+	clean := false
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		c.Close()
+		e.drain.websocketClosed(r, clean)
+		logger.Info("websocket closed", "clean", clean)
+	}()
+
+	go func() {
+		select {
+		case <-done:
+		case <-e.stopped.done():
+			logger.Info("Shutdown signal received. initiating websocket close.")
+			message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "webserver is shutting down")
+			grace := e.gracePeriod()
+			if err := c.WriteControl(websocket.CloseMessage, message, time.Now().Add(grace)); err != nil {
+				logger.Error(err, "unable to send CloseMessage")
+			} else {
+				logger.Info("CloseMessage sent, waiting for the client to close", "grace", grace.String())
+			}
+			// the read loop ends when the client replies with its own close
+			// message, or is forced to end once the grace period has passed
+			c.SetReadDeadline(time.Now().Add(grace))
+		}
+	}()
+
+	for {
 		logger.V(3).Info("reading from the websocket")
 		mt, message, err := c.ReadMessage()
 		if err != nil {
 			if ce, ok := err.(*websocket.CloseError); ok {
 				logger.Error(err, "connection closed", "code", ce.Code)
+				clean = closedCleanly(ce)
 				break
 			}
 			logger.Error(err, "read failed")
@@ -61,17 +96,14 @@ func (e *Echo) Handle(w http.ResponseWriter, r *http.Request) {
 			logger.Error(err, "write failed")
 			break
 		}
+		e.metrics.websocketMessage(mt)
 	}
+}
 
-	if !e.isRunning() {
-		logger.Info("Shutdown signal received. initiating websocket close.")
-		message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "webserver is shutting down")
-		grace := time.Duration(e.shutdownGracePeriodSeconds)
-		c.WriteMessage(websocket.CloseMessage, message)
-
-		time.Sleep(grace)
-		logger.Info("CloseMessage sent")
-	}
+// closedCleanly reports whether the peer sent a close message. gorilla
+// reports a connection dropped without one as CloseAbnormalClosure.
+func closedCleanly(ce *websocket.CloseError) bool {
+	return ce.Code != websocket.CloseAbnormalClosure
 }
 
 func messageTypeString(messageType int) string {
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestClosedCleanly(t *testing.T) {
+	tests := []struct {
+		code int
+		want bool
+	}{
+		{code: websocket.CloseNormalClosure, want: true},
+		{code: websocket.CloseGoingAway, want: true},
+		{code: websocket.CloseNoStatusReceived, want: true},
+		{code: websocket.CloseInternalServerErr, want: true},
+		{code: websocket.CloseAbnormalClosure, want: false},
+	}
+	for _, tt := range tests {
+		if got := closedCleanly(&websocket.CloseError{Code: tt.code}); got != tt.want {
+			t.Errorf("closedCleanly(%d) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestEchoDrainCountsCloses(t *testing.T) {
+	tests := []struct {
+		name     string
+		close    func(c *websocket.Conn)
+		cleanly  int64
+		forcibly int64
+	}{
+		{
+			name: "close message",
+			close: func(c *websocket.Conn) {
+				c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				c.ReadMessage()
+				c.Close()
+			},
+			cleanly: 1,
+		},
+		{
+			name:     "connection dropped",
+			close:    func(c *websocket.Conn) { c.UnderlyingConn().Close() },
+			forcibly: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drain := newDrainTracker()
+			echo := &Echo{state: &serverState{lifecycle: NewLifecycle()}, drain: drain}
+			echo.Start()
+			server := httptest.NewServer(drain.wrap("/echo", echo.Handle))
+			defer server.Close()
+
+			c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/echo", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			drain.signal()
+			tt.close(c)
+
+			deadline := time.Now().Add(5 * time.Second)
+			for drain.websockets() > 0 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			s := drain.summary()
+			if s.WebsocketsClosedCleanly != tt.cleanly || s.WebsocketsClosedForcibly != tt.forcibly {
+				t.Errorf("closed cleanly %d, forcibly %d, want %d, %d", s.WebsocketsClosedCleanly, s.WebsocketsClosedForcibly, tt.cleanly, tt.forcibly)
+			}
+		})
+	}
+}
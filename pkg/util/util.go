@@ -36,13 +36,22 @@ func NewRequestID() string {
 
 // RequestContext generates a new context that includes a request id
 func RequestContext(r *http.Request) context.Context {
-	id := EnsureRequestID(r)
-	return context.WithValue(r.Context(), contextKeyRequestID, id)
+	return WithRequestID(r.Context(), EnsureRequestID(r))
 }
 
 // GetRequestID retrieves the request id from the request context
 func GetRequestID(r *http.Request) string {
-	id, _ := r.Context().Value(contextKeyRequestID).(string)
+	return RequestIDFromContext(r.Context())
+}
+
+// WithRequestID returns a copy of ctx that carries the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKeyRequestID, id)
+}
+
+// RequestIDFromContext retrieves the request id from a context
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKeyRequestID).(string)
 	return id
 }
 